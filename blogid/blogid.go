@@ -0,0 +1,179 @@
+package blogid
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrEmpty = errors.New("empty blog identifier")
+
+	// tumblr names are case insensitive and get lowercased here
+	nameRegexp = regexp.MustCompile(`^[a-z0-9](?:[a-z0-9-]{0,30}[a-z0-9])?$`)
+	// blogs can also be referred to by their uuid
+	uuidRegexp = regexp.MustCompile(`^t:[A-Za-z0-9_-]+$`)
+	postRegexp = regexp.MustCompile(`^[0-9]+$`)
+
+	// first path segments on www.tumblr.com that aren't blog names
+	reservedPaths = map[string]bool{
+		"blog":      true,
+		"dashboard": true,
+		"explore":   true,
+		"likes":     true,
+		"search":    true,
+		"settings":  true,
+		"tagged":    true,
+		"following": true,
+		"inbox":     true,
+	}
+)
+
+// a blog, and optionally one of its posts
+type Identifier struct {
+	// what the api wants: name.tumblr.com, a custom domain, or a t:uuid
+	Blog string
+	// 0 if the input didn't point at a post
+	PostID int64
+}
+
+func (id Identifier) String() string {
+	if id.PostID == 0 {
+		return id.Blog
+	}
+	return fmt.Sprintf("%s/post/%d", id.Blog, id.PostID)
+}
+
+// the tumblr name, or "" for custom domains and uuids
+func (id Identifier) Name() string {
+	if strings.HasSuffix(id.Blog, ".tumblr.com") {
+		return strings.TrimSuffix(id.Blog, ".tumblr.com")
+	}
+	return ""
+}
+
+// normalizes the ways people refer to a blog or post, e.g.
+//
+//	name, name.tumblr.com, https://name.tumblr.com/post/123/slug,
+//	https://www.tumblr.com/name, https://www.tumblr.com/name/123/slug,
+//	tumblr.com/blog/view/name, example.com/post/123 and t:uuid
+func Parse(s string) (Identifier, error) {
+	s = strings.TrimSpace(s)
+	if len(s) == 0 {
+		return Identifier{}, ErrEmpty
+	}
+
+	if uuidRegexp.MatchString(s) {
+		return Identifier{Blog: s}, nil
+	}
+
+	// a bare name
+	if !strings.ContainsAny(s, "./:") {
+		return fromName(s)
+	}
+
+	if !strings.Contains(s, "://") {
+		s = "https://" + s
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return Identifier{}, fmt.Errorf("invalid blog identifier %q: %v", s, err)
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if len(host) == 0 {
+		return Identifier{}, fmt.Errorf("invalid blog identifier %q: no host", s)
+	}
+
+	// names are lowercased anyway, and /Blog/View/ is still /blog/view/
+	segments := splitPath(strings.ToLower(u.Path))
+
+	switch {
+	case host == "tumblr.com" || host == "www.tumblr.com":
+		return parseTumblrPath(s, segments)
+	case strings.HasSuffix(host, ".tumblr.com"):
+		id, err := fromName(strings.TrimSuffix(host, ".tumblr.com"))
+		if err != nil {
+			return id, err
+		}
+		id.PostID, err = parseBlogPath(s, segments)
+		return id, err
+	default:
+		// custom domains work like name.tumblr.com
+		id := Identifier{Blog: host}
+		id.PostID, err = parseBlogPath(s, segments)
+		return id, err
+	}
+}
+
+// paths on www.tumblr.com:
+//
+//	/name, /name/123, /name/123/slug, /blog/view/name, /blog/view/name/123, /blog/name and /dashboard/blog/name
+func parseTumblrPath(s string, segments []string) (Identifier, error) {
+	switch {
+	case len(segments) >= 2 && segments[0] == "blog" && segments[1] == "view":
+		segments = segments[2:]
+	case len(segments) >= 2 && segments[0] == "dashboard" && segments[1] == "blog":
+		segments = segments[2:]
+	case len(segments) >= 2 && segments[0] == "blog":
+		segments = segments[1:]
+	case len(segments) != 0 && reservedPaths[segments[0]]:
+		segments = nil
+	}
+
+	if len(segments) == 0 {
+		return Identifier{}, fmt.Errorf("%q doesn't point at a blog", s)
+	}
+
+	id, err := fromName(segments[0])
+	if err != nil {
+		return id, err
+	}
+
+	// /name/123 or /name/post/123
+	rest := segments[1:]
+	if len(rest) != 0 && rest[0] == "post" {
+		rest = rest[1:]
+	}
+	if len(rest) != 0 && postRegexp.MatchString(rest[0]) {
+		id.PostID, err = strconv.ParseInt(rest[0], 10, 64)
+	}
+
+	return id, err
+}
+
+// paths on a blog's own domain, /post/123/slug is the only one we care about
+func parseBlogPath(s string, segments []string) (int64, error) {
+	if len(segments) >= 2 && (segments[0] == "post" || segments[0] == "image") && postRegexp.MatchString(segments[1]) {
+		id, err := strconv.ParseInt(segments[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid post id in %q: %v", s, err)
+		}
+		return id, nil
+	}
+
+	return 0, nil
+}
+
+func fromName(name string) (Identifier, error) {
+	name = strings.ToLower(name)
+	if !nameRegexp.MatchString(name) {
+		return Identifier{}, fmt.Errorf("%q isn't a valid blog name", name)
+	}
+
+	return Identifier{Blog: name + ".tumblr.com"}, nil
+}
+
+func splitPath(p string) []string {
+	var segments []string
+	for _, seg := range strings.Split(p, "/") {
+		if len(seg) != 0 {
+			segments = append(segments, seg)
+		}
+	}
+	return segments
+}
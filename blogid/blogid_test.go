@@ -0,0 +1,85 @@
+package blogid
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		blog string
+		post int64
+		err  bool
+	}{
+		{in: "name", blog: "name.tumblr.com"},
+		{in: "  Name ", blog: "name.tumblr.com"},
+		{in: "name.tumblr.com", blog: "name.tumblr.com"},
+		{in: "https://name.tumblr.com/", blog: "name.tumblr.com"},
+		{in: "https://name.tumblr.com/post/123/some-slug", blog: "name.tumblr.com", post: 123},
+		{in: "https://name.tumblr.com/image/123", blog: "name.tumblr.com", post: 123},
+		{in: "https://name.tumblr.com/tagged/art", blog: "name.tumblr.com"},
+		{in: "https://www.tumblr.com/name", blog: "name.tumblr.com"},
+		{in: "https://www.tumblr.com/name/123/slug", blog: "name.tumblr.com", post: 123},
+		{in: "https://www.tumblr.com/name/post/123", blog: "name.tumblr.com", post: 123},
+		{in: "tumblr.com/blog/view/name", blog: "name.tumblr.com"},
+		{in: "tumblr.com/blog/view/name/123", blog: "name.tumblr.com", post: 123},
+		{in: "tumblr.com/Blog/View/Name", blog: "name.tumblr.com"},
+		{in: "https://www.tumblr.com/blog/name", blog: "name.tumblr.com"},
+		{in: "https://www.tumblr.com/dashboard/blog/name", blog: "name.tumblr.com"},
+		{in: "https://www.tumblr.com/Dashboard/Blog/name", blog: "name.tumblr.com"},
+		{in: "https://www.tumblr.com/name-deactivated20200101", blog: "name-deactivated20200101.tumblr.com"},
+		{in: "example.com", blog: "example.com"},
+		{in: "https://Example.com./post/456/slug", blog: "example.com", post: 456},
+		{in: "t:abc_DEF-123", blog: "t:abc_DEF-123"},
+
+		{in: "", err: true},
+		{in: "   ", err: true},
+		{in: "-name", err: true},
+		{in: "na_me", err: true},
+		{in: "https://www.tumblr.com/", err: true},
+		{in: "https://www.tumblr.com/blog/view", err: true},
+		{in: "https://www.tumblr.com/blog/view/", err: true},
+		{in: "https://www.tumblr.com/dashboard/blog", err: true},
+		{in: "https://www.tumblr.com/dashboard", err: true},
+		{in: "https://www.tumblr.com/Explore/trending", err: true},
+		{in: "https://www.tumblr.com/tagged/art", err: true},
+	}
+
+	for _, tt := range tests {
+		id, err := Parse(tt.in)
+		if tt.err {
+			if err == nil {
+				t.Errorf("Parse(%q) = %+v, want an error", tt.in, id)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", tt.in, err)
+			continue
+		}
+		if id.Blog != tt.blog || id.PostID != tt.post {
+			t.Errorf("Parse(%q) = %+v, want {Blog:%s PostID:%d}", tt.in, id, tt.blog, tt.post)
+		}
+	}
+}
+
+func TestIdentifierName(t *testing.T) {
+	tests := []struct {
+		id   Identifier
+		name string
+		str  string
+	}{
+		{Identifier{Blog: "name.tumblr.com"}, "name", "name.tumblr.com"},
+		{Identifier{Blog: "name.tumblr.com", PostID: 123}, "name", "name.tumblr.com/post/123"},
+		{Identifier{Blog: "example.com"}, "", "example.com"},
+		{Identifier{Blog: "t:abc"}, "", "t:abc"},
+	}
+
+	for _, tt := range tests {
+		if name := tt.id.Name(); name != tt.name {
+			t.Errorf("%+v.Name() = %q, want %q", tt.id, name, tt.name)
+		}
+		if str := tt.id.String(); str != tt.str {
+			t.Errorf("%+v.String() = %q, want %q", tt.id, str, tt.str)
+		}
+	}
+}
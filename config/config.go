@@ -3,6 +3,7 @@ package config
 import (
     "os"
     "log"
+    "fmt"
     "github.com/pelletier/go-toml"
 )
 
@@ -10,9 +11,81 @@ type Config struct {
     APIKey string `toml:"api_key"`
     Concurrency int `toml:"concurrency"`
     Save string `toml:"save_location"`
+
+    // which posts to scrape: "all", "original" or "reblogs"
+    Posts string `toml:"posts"`
+    // if set, only trail entries from reblogs of these blogs are scraped, and original posts are skipped
+    RootBlogs []string `toml:"root_blogs"`
+
+    // any of "image", "gif", "video" and "audio", empty means all of them
+    MediaKinds []string `toml:"media_kinds"`
+    // images smaller than this are skipped
+    MinWidth int `toml:"min_width"`
+    MinHeight int `toml:"min_height"`
+    // in bytes, 0 means no limit
+    MaxFileSize int64 `toml:"max_file_size"`
+    // Content-Types like "video/mp4" or "image/*"
+    MIMEAllow []string `toml:"mime_allow"`
+    MIMEDeny []string `toml:"mime_deny"`
+    // let the CDN send WebP instead of the original GIF, PNG or JPEG
+    AllowWebP bool `toml:"allow_webp"`
+
+    // scrape posts again if they were edited since they were last scraped
+    ReprocessChanged bool `toml:"reprocess_changed"`
+
+    // how long downloads in progress get to finish after ^C, like "1m", "0" means no limit
+    DrainTimeout string `toml:"drain_timeout"`
+
+    // how many hook commands can run at once
+    HookConcurrency int `toml:"hook_concurrency"`
+    // commands run on events like a file being written, see Hook
+    Hooks []Hook `toml:"hooks"`
+
+    // failed files before the error-threshold webhook is sent, 0 means it never is
+    ErrorThreshold int `toml:"error_threshold" default:"10"`
+    // URLs that get events like a run finishing as JSON, see Webhook
+    Webhooks []Webhook `toml:"webhooks"`
 }
 
+const (
+    PostsAll = "all"
+    PostsOriginal = "original"
+    PostsReblogs = "reblogs"
+)
+
+const (
+    MediaImage = "image"
+    MediaGIF = "gif"
+    MediaVideo = "video"
+    MediaAudio = "audio"
+)
+
+// loads and validates the config and checks save_location is writable, see Load
 func LoadConfigOrDefault(path string) (*Config, error) {
+    cfg, err := Load(path)
+    if err != nil {
+        return nil, err
+    }
+
+    err = cfg.Validate()
+    if err != nil {
+        return nil, err
+    }
+
+    err = cfg.CheckSave()
+    if err != nil {
+        return nil, err
+    }
+
+    return cfg, nil
+}
+
+// reads the config at path and applies the TUMTUM_* overrides, without validating it
+// if path is missing but path.bak is there, e.g. because `config init` was interrupted, the backup is restored
+// with neither, the defaults and the overrides are all there is, e.g. in a container, unless there aren't any overrides either
+func Load(path string) (*Config, error) {
+    found := true
+
     cfg, err := loadConfig(path)
     if err != nil {
         if !os.IsNotExist(err) {
@@ -20,20 +93,43 @@ func LoadConfigOrDefault(path string) (*Config, error) {
         }
 
         cfg, err = loadConfig(path + ".bak")
-        if err != nil {
-            if !os.IsNotExist(err) {
+        if err == nil {
+            log.Printf("recovering backup config file %s.bak", path)
+
+            err = copyFile(path + ".bak", path)
+            if err != nil {
+                return nil, err
+            }
+        } else if os.IsNotExist(err) {
+            found = false
+            cfg, err = defaultConfig()
+            if err != nil {
                 return nil, err
             }
-
-            log.Fatal("config file not found")
         } else {
-            // ???
-            log.Print("recovering backup config file")
+            return nil, err
         }
     }
 
-    if cfg.Concurrency <= 0 {
-        cfg.Concurrency = 20
+    applied, err := cfg.applyEnv()
+    if err != nil {
+        return nil, err
+    }
+
+    if !found && applied == 0 {
+        return nil, &NotFoundError{Path: path}
+    }
+
+    return cfg, nil
+}
+
+// what an empty tumtum.toml would give, i.e. the default tags filled in
+func defaultConfig() (*Config, error) {
+    cfg := &Config{}
+
+    err := toml.Unmarshal([]byte{}, cfg)
+    if err != nil {
+        return nil, err
     }
 
     return cfg, nil
@@ -50,7 +146,7 @@ func loadConfig(path string) (*Config, error) {
 
     err = toml.NewDecoder(f).Decode(cfg)
     if err != nil {
-        return nil, err
+        return nil, fmt.Errorf("%s: %v", path, err)
     }
 
     return cfg, nil
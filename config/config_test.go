@@ -0,0 +1,169 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writes toml to a tumtum.toml in a new directory, which is also the save location
+func writeConfig(t *testing.T, toml string) (path string, cleanup func()) {
+	dir, err := ioutil.TempDir("", "tumtum-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path = filepath.Join(dir, "tumtum.toml")
+	toml = "api_key = \"key\"\nsave_location = \"" + filepath.ToSlash(filepath.Join(dir, "save")) + "\"\n" + toml
+
+	err = ioutil.WriteFile(path, []byte(toml), 0644)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return path, func() { os.RemoveAll(dir) }
+}
+
+func TestWebhookDefaults(t *testing.T) {
+	tests := []struct {
+		name      string
+		toml      string
+		threshold int
+		retries   int
+	}{
+		{"missing", "[[webhooks]]\nurl = \"http://localhost/hook\"\n", 10, 3},
+		{"zero", "error_threshold = 0\n[[webhooks]]\nurl = \"http://localhost/hook\"\nretries = 0\n", 0, 0},
+		{"set", "error_threshold = 2\n[[webhooks]]\nurl = \"http://localhost/hook\"\nretries = 5\n", 2, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, cleanup := writeConfig(t, tt.toml)
+			defer cleanup()
+
+			cfg, err := LoadConfigOrDefault(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if cfg.ErrorThreshold != tt.threshold {
+				t.Errorf("error_threshold is %d, want %d", cfg.ErrorThreshold, tt.threshold)
+			}
+			if len(cfg.Webhooks) != 1 {
+				t.Fatalf("got %d webhooks, want 1", len(cfg.Webhooks))
+			}
+			if cfg.Webhooks[0].Retries != tt.retries {
+				t.Errorf("retries is %d, want %d", cfg.Webhooks[0].Retries, tt.retries)
+			}
+		})
+	}
+}
+
+func TestWebhookNegative(t *testing.T) {
+	for _, toml := range []string{
+		"error_threshold = -1\n",
+		"[[webhooks]]\nurl = \"http://localhost/hook\"\nretries = -1\n",
+	} {
+		path, cleanup := writeConfig(t, toml)
+
+		_, err := LoadConfigOrDefault(path)
+		if err == nil {
+			t.Errorf("%q is valid", toml)
+		}
+
+		cleanup()
+	}
+}
+
+// sets the variables until the returned func is called
+func setEnv(vars map[string]string) func() {
+	for k, v := range vars {
+		os.Setenv(k, v)
+	}
+
+	return func() {
+		for k := range vars {
+			os.Unsetenv(k)
+		}
+	}
+}
+
+func TestLoadFromEnvOnly(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tumtum-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "tumtum.toml")
+
+	_, err = Load(path)
+	if _, ok := err.(*NotFoundError); !ok {
+		t.Fatalf("got %v without a file or overrides, want a NotFoundError", err)
+	}
+
+	defer setEnv(map[string]string{
+		"TUMTUM_API_KEY":       "key",
+		"TUMTUM_SAVE_LOCATION": filepath.Join(dir, "save"),
+		// can't be set from the environment, but mustn't break the rest either
+		"TUMTUM_HOOKS":    "echo",
+		"TUMTUM_WEBHOOKS": "http://localhost/hook",
+	})()
+
+	cfg, err := LoadConfigOrDefault(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.APIKey != "key" || cfg.Save != filepath.Join(dir, "save") {
+		t.Errorf("api_key %q and save_location %q aren't from the environment", cfg.APIKey, cfg.Save)
+	}
+	if cfg.ErrorThreshold != 10 || cfg.Concurrency != 20 {
+		t.Errorf("error_threshold %d and concurrency %d aren't the defaults", cfg.ErrorThreshold, cfg.Concurrency)
+	}
+	if len(cfg.Hooks) != 0 || len(cfg.Webhooks) != 0 {
+		t.Errorf("hooks %v and webhooks %v were set from the environment", cfg.Hooks, cfg.Webhooks)
+	}
+}
+
+func TestValidateLeavesSaveAlone(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tumtum-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cfg := &Config{APIKey: "key", Save: dir}
+	err = cfg.Validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Validate left %d files in save_location", len(entries))
+	}
+
+	// a file where the directory should be
+	file := filepath.Join(dir, "file")
+	err = ioutil.WriteFile(file, nil, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg = &Config{APIKey: "key", Save: file}
+	err = cfg.Validate()
+	if err != nil {
+		t.Errorf("Validate checked save_location: %v", err)
+	}
+
+	err = cfg.CheckSave()
+	if verr, ok := err.(*ValidationError); !ok || verr.Reason != ErrUnwritable {
+		t.Errorf("CheckSave of a file gave %v, want an ErrUnwritable ValidationError", err)
+	}
+}
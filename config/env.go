@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const envPrefix = "TUMTUM_"
+
+// every setting can be overridden with TUMTUM_ + its toml key in upper case, e.g. TUMTUM_API_KEY
+// lists are comma separated, hooks and webhooks can only be set in the file
+// returns how many settings were overridden
+func (cfg *Config) applyEnv() (int, error) {
+	v := reflect.ValueOf(cfg).Elem()
+	t := v.Type()
+	applied := 0
+
+	for i := 0; i < t.NumField(); i++ {
+		name, ok := envName(t.Field(i))
+		if !ok {
+			continue
+		}
+
+		s, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+
+		err := setFromString(v.Field(i), s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s: %v", name, err)
+		}
+		applied++
+	}
+
+	return applied, nil
+}
+
+// the names of the variables that override settings, e.g. to keep TUMTUM_API_KEY from commands tumtum runs
+func EnvOverrides() map[string]bool {
+	names := make(map[string]bool)
+
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		if name, ok := envName(t.Field(i)); ok {
+			names[name] = true
+		}
+	}
+
+	return names
+}
+
+// the variable that overrides f, if it can be set from a string
+func envName(f reflect.StructField) (string, bool) {
+	key := strings.Split(f.Tag.Get("toml"), ",")[0]
+	if len(key) == 0 || key == "-" {
+		return "", false
+	}
+
+	// lists of tables like [[hooks]]
+	if f.Type.Kind() == reflect.Slice && f.Type.Elem().Kind() == reflect.Struct {
+		return "", false
+	}
+
+	return envPrefix + strings.ToUpper(key), true
+}
+
+func setFromString(f reflect.Value, s string) error {
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		f.SetInt(n)
+	case reflect.Slice:
+		if f.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", f.Type())
+		}
+
+		var items []string
+		for _, item := range strings.Split(s, ",") {
+			item = strings.TrimSpace(item)
+			if len(item) != 0 {
+				items = append(items, item)
+			}
+		}
+		f.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported type %s", f.Type())
+	}
+
+	return nil
+}
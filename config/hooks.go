@@ -0,0 +1,83 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// events hooks can run on
+const (
+	HookFileWritten = "file-written"
+	HookPostDone    = "post-done"
+	HookBlogDone    = "blog-done"
+	HookRunDone     = "run-done"
+)
+
+// what happens when a hook fails or times out
+const (
+	// log it and carry on
+	HookFailureLog = "log"
+	// stop scraping, the run ends with the hook's error
+	HookFailureAbort = "abort"
+)
+
+// a command that's run on an event, with TUMTUM_* environment variables describing it
+type Hook struct {
+	Event string `toml:"event"`
+	// the program and its arguments, there's no shell involved unless it's ["sh", "-c", "..."]
+	Command []string `toml:"command"`
+	// like "30s", "0" means no limit
+	Timeout   string `toml:"timeout"`
+	OnFailure string `toml:"on_failure"`
+}
+
+// only valid after Validate
+func (h *Hook) TimeoutDuration() time.Duration {
+	d, _ := time.ParseDuration(h.Timeout)
+	return d
+}
+
+func (cfg *Config) validateHooks() error {
+	if cfg.HookConcurrency == 0 {
+		cfg.HookConcurrency = 4
+	}
+
+	if cfg.HookConcurrency < 0 {
+		return &ValidationError{Key: "hook_concurrency", Reason: ErrInvalid, Detail: fmt.Sprintf("%d is not a positive number", cfg.HookConcurrency)}
+	}
+
+	for i := range cfg.Hooks {
+		h := &cfg.Hooks[i]
+		key := fmt.Sprintf("hooks[%d]", i)
+
+		switch h.Event {
+		case HookFileWritten, HookPostDone, HookBlogDone, HookRunDone:
+			// ok
+		default:
+			return &ValidationError{Key: key + ".event", Reason: ErrInvalid, Detail: fmt.Sprintf("%q must be one of %q, %q, %q or %q", h.Event, HookFileWritten, HookPostDone, HookBlogDone, HookRunDone)}
+		}
+
+		if len(h.Command) == 0 || len(h.Command[0]) == 0 {
+			return &ValidationError{Key: key + ".command", Reason: ErrMissing}
+		}
+
+		if len(h.Timeout) == 0 {
+			h.Timeout = "1m"
+		}
+
+		if d, err := time.ParseDuration(h.Timeout); err != nil || d < 0 {
+			return &ValidationError{Key: key + ".timeout", Reason: ErrInvalid, Detail: fmt.Sprintf("%q is not a duration like \"30s\"", h.Timeout)}
+		}
+
+		switch h.OnFailure {
+		case "":
+			h.OnFailure = HookFailureLog
+		case HookFailureLog, HookFailureAbort:
+			// ok
+		default:
+			return &ValidationError{Key: key + ".on_failure", Reason: ErrInvalid, Detail: fmt.Sprintf("%q must be %q or %q", h.OnFailure, HookFailureLog, HookFailureAbort)}
+		}
+	}
+
+	return nil
+}
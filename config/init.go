@@ -0,0 +1,198 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/pelletier/go-toml"
+)
+
+var defaultConfigTemplate = template.Must(template.New("tumtum.toml").Parse(`# tumtum config
+# every setting can also be set from the environment as TUMTUM_ + its name in upper case,
+# e.g. TUMTUM_API_KEY, which keeps the api key out of this file
+
+# tumblr api key, register an application at https://www.tumblr.com/oauth/apps to get one
+api_key = ""
+
+# where everything gets saved to
+save_location = {{ printf "%q" .Save }}
+
+# how many requests are made at once
+concurrency = 20
+
+# which posts to scrape: "all", "original" or "reblogs"
+# posts = "all"
+
+# only keep media reblogged from these blogs
+# root_blogs = []
+
+# any of "image", "gif", "video" and "audio", empty means all of them
+# media_kinds = []
+
+# images smaller than this are skipped
+# min_width = 0
+# min_height = 0
+
+# in bytes, 0 means no limit
+# max_file_size = 0
+
+# Content-Types like "video/mp4" or "image/*"
+# mime_allow = []
+# mime_deny = []
+
+# tumblr sends WebP instead of the original GIF, PNG or JPEG if asked nicely, which is smaller but not the original
+# allow_webp = false
+
+# scrape posts again if they were edited since they were last scraped
+# reprocess_changed = false
+
+# how long downloads in progress get to finish after ^C, "0" means no limit
+# a second ^C always stops right away
+# drain_timeout = "1m"
+
+# how many hook commands can run at once
+# hook_concurrency = 4
+
+# commands to run on "file-written", "post-done", "blog-done" and "run-done",
+# with the details in TUMTUM_* environment variables like TUMTUM_PATH, TUMTUM_BLOG and TUMTUM_POST_ID
+# on_failure is "log" to carry on or "abort" to stop scraping, timeout "0" means no limit
+# [[hooks]]
+# event = "file-written"
+# command = ["sh", "-c", "echo \"$TUMTUM_PATH\" >> written.txt"]
+# timeout = "1m"
+# on_failure = "log"
+
+# how many files can fail before the "error-threshold" webhook is sent, 0 means it never is
+# error_threshold = 10
+
+# URLs to POST "run-started", "run-finished", "blog-finished", "error-threshold" and "quota-exhausted" events to as JSON
+# with secret set, the body's HMAC-SHA256 is sent as X-Tumtum-Signature: sha256=<hex>
+# no events means all of them, failed deliveries are tried again up to retries times, 0 means they aren't
+# [[webhooks]]
+# url = "http://localhost:8080/tumtum"
+# secret = ""
+# events = ["run-finished", "quota-exhausted"]
+# retries = 3
+# timeout = "10s"
+`))
+
+// writes a commented default config to path
+// an existing config is kept as path.bak, unless overwrite is false, in which case it's an error
+func WriteDefault(path string, overwrite bool) error {
+	if _, err := os.Stat(path); err == nil && !overwrite {
+		return fmt.Errorf("%s already exists", path)
+	}
+
+	save := "tumtum"
+	if home, err := os.UserHomeDir(); err == nil {
+		save = filepath.Join(home, "tumtum")
+	}
+
+	var buf bytes.Buffer
+	err := defaultConfigTemplate.Execute(&buf, struct{ Save string }{save})
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(path, buf.Bytes())
+}
+
+// the new file is written next to path and renamed over it, so path is either the old or the new config
+// the old one is kept as path.bak, and Load restores it if we crash in between the two renames
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(dir, filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		// the api key ends up in here
+		err = os.Chmod(tmp, 0600)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		err = os.Rename(path, path+".bak")
+		if err != nil {
+			_ = os.Remove(tmp)
+			return err
+		}
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(out, in)
+	if e := out.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		_ = os.Remove(dst)
+	}
+
+	return err
+}
+
+// writes the config as toml, with secrets masked
+func (cfg *Config) Show(w io.Writer) error {
+	masked := *cfg
+	masked.APIKey = maskSecret(cfg.APIKey)
+
+	masked.Webhooks = nil
+	for _, w := range cfg.Webhooks {
+		w.Secret = maskSecret(w.Secret)
+		masked.Webhooks = append(masked.Webhooks, w)
+	}
+
+	data, err := toml.Marshal(masked)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(data)
+	return err
+}
+
+// keeps the last 4 characters so keys can still be told apart
+func maskSecret(s string) string {
+	if len(s) <= 8 {
+		return strings.Repeat("*", len(s))
+	}
+	return strings.Repeat("*", len(s)-4) + s[len(s)-4:]
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+)
+
+const (
+	configName = "tumtum.toml"
+	dbName     = "tumtum.db"
+)
+
+// where tumtum.toml is looked for if --config isn't given
+// a tumtum.toml in the working directory still wins so existing setups keep working
+func DefaultPath() string {
+	return defaultPath(configName, "XDG_CONFIG_HOME", ".config")
+}
+
+// where tumtum.db is kept if --db isn't given, same rules as DefaultPath
+func DefaultDBPath() string {
+	return defaultPath(dbName, "XDG_DATA_HOME", filepath.Join(".local", "share"))
+}
+
+func defaultPath(name, xdgEnv, homeFallback string) string {
+	if _, err := os.Stat(name); err == nil {
+		return name
+	}
+
+	dir := os.Getenv(xdgEnv)
+	if len(dir) == 0 || !filepath.IsAbs(dir) {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			// nowhere better to go
+			return name
+		}
+		dir = filepath.Join(home, homeFallback)
+	}
+
+	return filepath.Join(dir, "tumtum", name)
+}
@@ -0,0 +1,147 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	// reasons a ValidationError can have, check with errors.Is
+	ErrMissing    = errors.New("is not set")
+	ErrInvalid    = errors.New("is invalid")
+	ErrUnwritable = errors.New("is not writable")
+)
+
+// no config file, and no backup of one either
+type NotFoundError struct {
+	Path string
+}
+
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("config file %s not found, create one with `tumtum config init`", e.Path)
+}
+
+// a setting that doesn't make sense
+type ValidationError struct {
+	Key    string // as in tumtum.toml
+	Reason error  // one of ErrMissing, ErrInvalid or ErrUnwritable
+	Detail string // optional
+}
+
+func (e *ValidationError) Error() string {
+	msg := fmt.Sprintf("%s %v", e.Key, e.Reason)
+	if len(e.Detail) != 0 {
+		msg += ": " + e.Detail
+	}
+	return msg
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Reason
+}
+
+// fills in defaults and checks the settings make sense, without touching the filesystem, see CheckSave
+func (cfg *Config) Validate() error {
+	if len(cfg.APIKey) == 0 {
+		return &ValidationError{Key: "api_key", Reason: ErrMissing, Detail: "set it in the config or with TUMTUM_API_KEY"}
+	}
+
+	if len(cfg.Save) == 0 {
+		return &ValidationError{Key: "save_location", Reason: ErrMissing}
+	}
+
+	if cfg.Concurrency == 0 {
+		cfg.Concurrency = 20
+	}
+
+	if cfg.Concurrency < 0 {
+		return &ValidationError{Key: "concurrency", Reason: ErrInvalid, Detail: fmt.Sprintf("%d is not a positive number", cfg.Concurrency)}
+	}
+
+	switch cfg.Posts {
+	case "":
+		cfg.Posts = PostsAll
+	case PostsAll, PostsOriginal, PostsReblogs:
+		// ok
+	default:
+		return &ValidationError{Key: "posts", Reason: ErrInvalid, Detail: fmt.Sprintf("%q must be one of %q, %q or %q", cfg.Posts, PostsAll, PostsOriginal, PostsReblogs)}
+	}
+
+	for _, k := range cfg.MediaKinds {
+		switch k {
+		case MediaImage, MediaGIF, MediaVideo, MediaAudio:
+			// ok
+		default:
+			return &ValidationError{Key: "media_kinds", Reason: ErrInvalid, Detail: fmt.Sprintf("%q must be one of %q, %q, %q or %q", k, MediaImage, MediaGIF, MediaVideo, MediaAudio)}
+		}
+	}
+
+	if len(cfg.DrainTimeout) == 0 {
+		cfg.DrainTimeout = "1m"
+	}
+
+	if d, err := time.ParseDuration(cfg.DrainTimeout); err != nil || d < 0 {
+		return &ValidationError{Key: "drain_timeout", Reason: ErrInvalid, Detail: fmt.Sprintf("%q is not a duration like \"1m\"", cfg.DrainTimeout)}
+	}
+
+	for _, t := range append(append([]string{}, cfg.MIMEAllow...), cfg.MIMEDeny...) {
+		if !strings.Contains(t, "/") {
+			return &ValidationError{Key: "mime_allow/mime_deny", Reason: ErrInvalid, Detail: fmt.Sprintf("%q is not a MIME type", t)}
+		}
+	}
+
+	err := cfg.validateHooks()
+	if err != nil {
+		return err
+	}
+
+	return cfg.validateWebhooks()
+}
+
+// checks that files can be saved to save_location, which means creating one, so only for commands that download
+func (cfg *Config) CheckSave() error {
+	err := checkWritable(cfg.Save)
+	if err != nil {
+		return &ValidationError{Key: "save_location", Reason: ErrUnwritable, Detail: err.Error()}
+	}
+
+	return nil
+}
+
+// dir doesn't have to exist yet, as long as it can be created
+func checkWritable(dir string) error {
+	fi, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return err
+		}
+		return checkWritable(parent)
+	}
+	if err != nil {
+		return err
+	}
+
+	if !fi.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	f, err := ioutil.TempFile(dir, ".tumtum-")
+	if err != nil {
+		return err
+	}
+
+	_ = f.Close()
+	return os.Remove(f.Name())
+}
+
+// drain_timeout as a duration, only valid after Validate
+func (cfg *Config) Drain() time.Duration {
+	d, _ := time.ParseDuration(cfg.DrainTimeout)
+	return d
+}
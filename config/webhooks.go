@@ -0,0 +1,100 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// events webhooks are sent for
+const (
+	WebhookRunStarted     = "run-started"
+	WebhookRunFinished    = "run-finished"
+	WebhookBlogFinished   = "blog-finished"
+	WebhookErrorThreshold = "error-threshold"
+	WebhookQuotaExhausted = "quota-exhausted"
+)
+
+var webhookEvents = []string{WebhookRunStarted, WebhookRunFinished, WebhookBlogFinished, WebhookErrorThreshold, WebhookQuotaExhausted}
+
+// a URL events are POSTed to as JSON
+type Webhook struct {
+	URL string `toml:"url"`
+	// if set, the body is signed with HMAC-SHA256 in the X-Tumtum-Signature header
+	Secret string `toml:"secret"`
+	// empty means all of them
+	Events []string `toml:"events"`
+	// how many more times a delivery is tried after failing, 0 means it isn't
+	Retries int `toml:"retries" default:"3"`
+	// per attempt, like "10s"
+	Timeout string `toml:"timeout"`
+}
+
+// only valid after Validate
+func (w *Webhook) TimeoutDuration() time.Duration {
+	d, _ := time.ParseDuration(w.Timeout)
+	return d
+}
+
+// whether w wants event
+func (w *Webhook) Wants(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (cfg *Config) validateWebhooks() error {
+	if cfg.ErrorThreshold < 0 {
+		return &ValidationError{Key: "error_threshold", Reason: ErrInvalid, Detail: fmt.Sprintf("%d is negative", cfg.ErrorThreshold)}
+	}
+
+	for i := range cfg.Webhooks {
+		w := &cfg.Webhooks[i]
+		key := fmt.Sprintf("webhooks[%d]", i)
+
+		if len(w.URL) == 0 {
+			return &ValidationError{Key: key + ".url", Reason: ErrMissing}
+		}
+
+		if u, err := url.Parse(w.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+			return &ValidationError{Key: key + ".url", Reason: ErrInvalid, Detail: fmt.Sprintf("%q is not an http or https URL", w.URL)}
+		}
+
+		for _, e := range w.Events {
+			if !isWebhookEvent(e) {
+				return &ValidationError{Key: key + ".events", Reason: ErrInvalid, Detail: fmt.Sprintf("%q must be one of %q", e, webhookEvents)}
+			}
+		}
+
+		if w.Retries < 0 {
+			return &ValidationError{Key: key + ".retries", Reason: ErrInvalid, Detail: fmt.Sprintf("%d is negative", w.Retries)}
+		}
+
+		if len(w.Timeout) == 0 {
+			w.Timeout = "10s"
+		}
+
+		if d, err := time.ParseDuration(w.Timeout); err != nil || d <= 0 {
+			return &ValidationError{Key: key + ".timeout", Reason: ErrInvalid, Detail: fmt.Sprintf("%q is not a duration like \"10s\"", w.Timeout)}
+		}
+	}
+
+	return nil
+}
+
+func isWebhookEvent(event string) bool {
+	for _, e := range webhookEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
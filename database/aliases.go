@@ -0,0 +1,65 @@
+package database
+
+import (
+	"go.etcd.io/bbolt"
+)
+
+// other names a blog was scraped as, like its custom domain, its uuid or what it was called before a rename,
+// mapped to the name its posts and info are kept under
+var aliasesObj = []byte("aliases")
+
+// returns the name alias is kept under, or false if it's not an alias
+func (s *Database) ResolveAlias(alias string) (string, bool, error) {
+	var (
+		blog  string
+		found bool
+	)
+
+	err := s.get().View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(aliasesObj)
+		if b == nil {
+			return nil
+		}
+
+		data := b.Get([]byte(alias))
+		if data == nil {
+			return nil
+		}
+
+		blog, found = string(data), true
+		return nil
+	})
+
+	return blog, found, err
+}
+
+// records that alias refers to blog from now on
+func (s *Database) AddAlias(alias, blog string) error {
+	return s.get().Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(aliasesObj)
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(alias), []byte(blog))
+	})
+}
+
+// returns every alias and the name it's kept under
+func (s *Database) Aliases() (map[string]string, error) {
+	aliases := make(map[string]string)
+
+	err := s.get().View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(aliasesObj)
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			aliases[string(k)] = string(v)
+			return nil
+		})
+	})
+
+	return aliases, err
+}
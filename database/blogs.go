@@ -0,0 +1,87 @@
+package database
+
+import (
+	"encoding/json"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+var blogsObj = []byte("blogs")
+
+// what /blog/{blog}/info said about a blog the last time we asked, keyed by the name it was scraped as
+type BlogInfo struct {
+	Name        string `json:"name"`
+	UUID        string `json:"uuid"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	URL         string `json:"url"`
+	Posts       int64  `json:"posts"`
+	// unix time of the blog's last post or edit
+	Updated int64 `json:"updated"`
+	// Updated as of the last sync that ran to completion
+	Synced  int64     `json:"synced"`
+	Fetched time.Time `json:"fetched"`
+}
+
+// returns nil if the blog's info was never saved
+func (s *Database) BlogInfo(blog string) (*BlogInfo, error) {
+	var info *BlogInfo
+
+	err := s.get().View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(blogsObj)
+		if b == nil {
+			return nil
+		}
+
+		data := b.Get([]byte(blog))
+		if data == nil {
+			return nil
+		}
+
+		info = &BlogInfo{}
+		return json.Unmarshal(data, info)
+	})
+
+	return info, err
+}
+
+func (s *Database) SetBlogInfo(blog string, info *BlogInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	return s.get().Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(blogsObj)
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(blog), data)
+	})
+}
+
+// returns the info of every blog that was scraped, by the name it was scraped as
+func (s *Database) Blogs() (map[string]*BlogInfo, error) {
+	infos := make(map[string]*BlogInfo)
+
+	err := s.get().View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(blogsObj)
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			info := &BlogInfo{}
+			err := json.Unmarshal(v, info)
+			if err != nil {
+				return err
+			}
+			infos[string(k)] = info
+			return nil
+		})
+	})
+
+	return infos, err
+}
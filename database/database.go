@@ -1,6 +1,8 @@
 package database
 
 import (
+	"os"
+	"path/filepath"
 	"strconv"
 	"time"
 
@@ -10,102 +12,165 @@ import (
 var (
 	timeObj   = []byte("time")
 	offsetObj = []byte("offset")
+
+	// the cursor from before there was one per blog, blog names can't have underscores
+	legacyCursorKey = []byte("_legacy")
 )
 
-type Database bbolt.DB
+type Database struct {
+	db *bbolt.DB
+
+	// only set for the handle that holds the write lock
+	pidfile string
+	// only set when the db was copied because someone else holds the write lock
+	snapshot string
+	locked   *LockedError
+}
 
 // create new DB
-func NewDB() (*Database, error) {
-	db, err := bbolt.Open("tumtum.db", 0644, nil)
+// fails with a *LockedError if another tumtum has it open
+func NewDB(path string) (*Database, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0755)
 	if err != nil {
 		return nil, err
 	}
 
-	err = db.Update(func(tx *bbolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists(timeObj)
-		return err
-	})
+	db, err := openLocked(path)
 	if err != nil {
 		return nil, err
 	}
 
-	err = db.Update(func(tx *bbolt.Tx) error {
-		_, err := tx.CreateBucketIfNotExists(offsetObj)
-		return err
-	})
+	err = migrate(db)
 	if err != nil {
+		_ = db.Close()
 		return nil, err
 	}
 
-	return (*Database)(db), nil
+	s := &Database{db: db}
+
+	s.pidfile, err = writePidfile(path)
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// opens the db at path with the exclusive lock
+// compact and restore replace the file, so the lock might be on one that's gone by the time we get it
+func openLocked(path string) (*bbolt.DB, error) {
+	for attempt := 0; ; attempt++ {
+		var file *os.File
+		db, err := bbolt.Open(path, 0644, &bbolt.Options{
+			Timeout: lockTimeout,
+			OpenFile: func(name string, flag int, perm os.FileMode) (f *os.File, err error) {
+				f, err = os.OpenFile(name, flag, perm)
+				file = f
+				return
+			},
+		})
+		if err == bbolt.ErrTimeout {
+			return nil, newLockedError(path)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		replaced, err := isReplaced(file, path)
+		if err == nil && !replaced {
+			return db, nil
+		}
+
+		_ = db.Close()
+		if err != nil {
+			return nil, err
+		}
+		if attempt == 2 {
+			return nil, newLockedError(path)
+		}
+	}
+}
+
+// whether f, which was opened as path, isn't at path anymore
+func isReplaced(f *os.File, path string) (bool, error) {
+	open, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+
+	current, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return !os.SameFile(open, current), nil
 }
 
 // closes DB
 func (s *Database) Close() error {
-	return s.get().Close()
+	err := s.get().Close()
+
+	if len(s.pidfile) != 0 {
+		_ = os.Remove(s.pidfile)
+	}
+	if len(s.snapshot) != 0 {
+		_ = os.Remove(s.snapshot)
+	}
+
+	return err
 }
 
 func (s *Database) get() *bbolt.DB {
-	return (*bbolt.DB)(s)
+	return s.db
 }
 
-// returns time.Time{}
-func (s *Database) GetTime(b string) (time.Time, error) {
-	var i int64
-
-	err := s.get().Update(func(tx *bbolt.Tx) error {
-		b, err := tx.CreateBucketIfNotExists(timeObj)
-		if err != nil {
-			return err
-		}
+// where the backfill of a blog left off
+type Cursor struct {
+	Time time.Time
+	// how many posts it got through
+	Offset int64
+}
 
-		data := b.Get([]byte("time"))
-		if len(data) == 0 {
-			return nil
-		}
+// returns time.Time{} if the blog's backfill never got anywhere
+func (s *Database) GetTime(blog string) (time.Time, error) {
+	var i int64
 
-		i, err = strconv.ParseInt(string(data), 10, 64)
-		return err
+	err := s.get().View(func(tx *bbolt.Tx) (err error) {
+		i, err = getInt(tx.Bucket(timeObj), blog)
+		return
 	})
 
 	if err != nil {
 		return time.Time{}, err
 	}
 
+	// nothing saved yet
+	if i == 0 {
+		return time.Time{}, nil
+	}
+
 	return time.Unix(i, 0), nil
 }
 
-// saves time.Time{} in unix
-func (s *Database) SetTime(t time.Time) error {
+// saves the blog's cursor in unix
+func (s *Database) SetTime(blog string, t time.Time) error {
 	return s.get().Update(func(tx *bbolt.Tx) error {
-		b, err := tx.CreateBucketIfNotExists(timeObj)
-		if err != nil {
-			return err
-		}
-
-		s := strconv.FormatInt(t.Unix(), 10)
-		return b.Put([]byte("time"), []byte(s))
+		return putInt(tx, timeObj, blog, t.Unix())
 	})
 }
 
 // use offset to paginate through the blog
 // returns offset
-func (s *Database) GetOffset(b string) (int64, error) {
+func (s *Database) GetOffset(blog string) (int64, error) {
 	var offset int64
 
-	err := s.get().Update(func(tx *bbolt.Tx) error {
-		b, err := tx.CreateBucketIfNotExists(offsetObj)
-		if err != nil {
-			return err
-		}
-
-		data := b.Get([]byte("offset"))
-		if len(data) == 0 {
-			return nil
-		}
-
-		offset, err = strconv.ParseInt(string(data), 10, 64)
-		return err
+	err := s.get().View(func(tx *bbolt.Tx) (err error) {
+		offset, err = getInt(tx.Bucket(offsetObj), blog)
+		return
 	})
 
 	if err != nil {
@@ -116,14 +181,139 @@ func (s *Database) GetOffset(b string) (int64, error) {
 }
 
 // sets offset
-func (s *Database) SetOffset(o int64) error {
+func (s *Database) SetOffset(blog string, o int64) error {
 	return s.get().Update(func(tx *bbolt.Tx) error {
-		b, err := tx.CreateBucketIfNotExists(offsetObj)
-		if err != nil {
+		return putInt(tx, offsetObj, blog, o)
+	})
+}
+
+// the cursor from before there was one per blog, if no blog adopted it yet
+func (s *Database) LegacyCursor() (c Cursor, found bool, err error) {
+	err = s.get().View(func(tx *bbolt.Tx) (err error) {
+		c, found, err = getCursor(tx, string(legacyCursorKey))
+		return
+	})
+	return
+}
+
+// gives blog the cursor from before there was one per blog, unless it has one of its own
+// the first blog scraped after upgrading is the one it was most likely saved for
+func (s *Database) AdoptLegacyCursor(blog string) (c Cursor, adopted bool, err error) {
+	err = s.get().Update(func(tx *bbolt.Tx) error {
+		_, found, err := getCursor(tx, blog)
+		if err != nil || found {
+			return err
+		}
+
+		c, adopted, err = getCursor(tx, string(legacyCursorKey))
+		if err != nil || !adopted {
 			return err
 		}
 
-		s := strconv.FormatInt(o, 10)
-		return b.Put([]byte("offset"), []byte(s))
+		for _, name := range [][]byte{timeObj, offsetObj} {
+			b := tx.Bucket(name)
+			if b == nil {
+				continue
+			}
+
+			if v := b.Get(legacyCursorKey); v != nil {
+				err = b.Put([]byte(blog), append([]byte(nil), v...))
+				if err != nil {
+					return err
+				}
+			}
+
+			err = b.Delete(legacyCursorKey)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
 	})
+	return
+}
+
+func getCursor(tx *bbolt.Tx, blog string) (Cursor, bool, error) {
+	t, err := getInt(tx.Bucket(timeObj), blog)
+	if err != nil {
+		return Cursor{}, false, err
+	}
+
+	o, err := getInt(tx.Bucket(offsetObj), blog)
+	if err != nil {
+		return Cursor{}, false, err
+	}
+
+	var c Cursor
+	if t != 0 {
+		c.Time = time.Unix(t, 0)
+	}
+	c.Offset = o
+
+	return c, t != 0 || o != 0, nil
+}
+
+// the cursors of every blog, by what it's kept under, without the legacy one
+func (s *Database) Cursors() (map[string]Cursor, error) {
+	cursors := make(map[string]Cursor)
+
+	err := s.get().View(func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{timeObj, offsetObj} {
+			b := tx.Bucket(name)
+			if b == nil {
+				continue
+			}
+
+			err := b.ForEach(func(k, v []byte) error {
+				if string(k) == string(legacyCursorKey) {
+					return nil
+				}
+
+				i, err := strconv.ParseInt(string(v), 10, 64)
+				if err != nil {
+					return err
+				}
+
+				c := cursors[string(k)]
+				if string(name) == string(timeObj) {
+					if i != 0 {
+						c.Time = time.Unix(i, 0)
+					}
+				} else {
+					c.Offset = i
+				}
+				cursors[string(k)] = c
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+
+	return cursors, err
+}
+
+// 0 if the bucket or key is missing
+func getInt(b *bbolt.Bucket, key string) (int64, error) {
+	if b == nil {
+		return 0, nil
+	}
+
+	data := b.Get([]byte(key))
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	return strconv.ParseInt(string(data), 10, 64)
+}
+
+func putInt(tx *bbolt.Tx, bucket []byte, key string, i int64) error {
+	b, err := tx.CreateBucketIfNotExists(bucket)
+	if err != nil {
+		return err
+	}
+
+	return b.Put([]byte(key), []byte(strconv.FormatInt(i, 10)))
 }
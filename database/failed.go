@@ -0,0 +1,59 @@
+package database
+
+import (
+	"encoding/json"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+var failedObj = []byte("failed")
+
+// a download that was given up on, keyed by its URL
+type Failure struct {
+	Blog   string    `json:"blog"`
+	PostID int64     `json:"post_id"`
+	Error  string    `json:"error"`
+	Time   time.Time `json:"time"`
+}
+
+// records that rawURL couldn't be downloaded, so the cursor can move past its post
+func (s *Database) RecordFailure(rawURL string, f *Failure) error {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	return s.get().Update(func(tx *bbolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(failedObj)
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(rawURL), data)
+	})
+}
+
+// returns every recorded failure by URL
+func (s *Database) Failures() (map[string]*Failure, error) {
+	fs := make(map[string]*Failure)
+
+	err := s.get().View(func(tx *bbolt.Tx) error {
+		b := tx.Bucket(failedObj)
+		if b == nil {
+			return nil
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			f := &Failure{}
+			err := json.Unmarshal(v, f)
+			if err != nil {
+				return err
+			}
+			fs[string(k)] = f
+			return nil
+		})
+	})
+
+	return fs, err
+}
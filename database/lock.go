@@ -0,0 +1,247 @@
+package database
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// bbolt waits forever for the file lock by default
+const lockTimeout = time.Second
+
+// the db is locked by another process
+type LockedError struct {
+	Path string
+	PID  int // 0 if unknown
+}
+
+func (e *LockedError) Error() string {
+	if e.PID == 0 {
+		return fmt.Sprintf("another tumtum is using %s", e.Path)
+	}
+	return fmt.Sprintf("another tumtum is running (pid %d) and using %s", e.PID, e.Path)
+}
+
+func newLockedError(path string) *LockedError {
+	e := &LockedError{Path: path}
+
+	data, err := ioutil.ReadFile(pidfilePath(path))
+	if err == nil {
+		e.PID, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+	}
+
+	return e
+}
+
+// the bbolt file lock is what actually keeps other instances out, the pidfile is only there to tell them who's got it
+func pidfilePath(path string) string {
+	return path + ".pid"
+}
+
+func writePidfile(path string) (string, error) {
+	p := pidfilePath(path)
+	err := ioutil.WriteFile(p, []byte(strconv.Itoa(os.Getpid())+"\n"), 0644)
+	return p, err
+}
+
+// opens the db for reading only, e.g. for status commands
+// if a scrape is holding the db, this opens a snapshot of it instead, which may be a moment behind
+// the db isn't migrated, so callers have to deal with older layouts
+func OpenReadOnly(path string) (*Database, error) {
+	// bbolt can't create a db in read only mode
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+
+	db, err := bbolt.Open(path, 0644, &bbolt.Options{ReadOnly: true, Timeout: lockTimeout})
+	if err == nil {
+		return checkReadOnly(&Database{db: db})
+	}
+	if err != bbolt.ErrTimeout {
+		return nil, err
+	}
+
+	snapshot, err := snapshotDB(path)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err = bbolt.Open(snapshot, 0644, &bbolt.Options{ReadOnly: true, Timeout: lockTimeout})
+	if err != nil {
+		_ = os.Remove(snapshot)
+		return nil, err
+	}
+
+	return checkReadOnly(&Database{db: db, snapshot: snapshot, locked: newLockedError(path)})
+}
+
+func checkReadOnly(s *Database) (*Database, error) {
+	var version int
+
+	err := s.get().View(func(tx *bbolt.Tx) (err error) {
+		version, err = schemaVersion(tx)
+		return
+	})
+	if err == nil && version > SchemaVersion() {
+		err = fmt.Errorf("%s has schema version %d, but this tumtum only knows up to %d", s.get().Path(), version, SchemaVersion())
+	}
+	if err != nil {
+		_ = s.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// copies the db while someone else is writing to it, the last resort when its lock can't be had
+// bbolt never overwrites pages of the last commit, but once a commit lands, pages freed by the one before it get reused,
+// so a copy is only kept if no commit landed while it was made, which the meta pages tell, and it passes tx.Check
+func snapshotDB(path string) (string, error) {
+	var lastErr error
+
+	for attempt := 0; attempt < 5; attempt++ {
+		if attempt != 0 {
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		before, err := readMetaPages(path)
+		if err != nil {
+			return "", err
+		}
+
+		snapshot, err := copyToTemp(path)
+		if err != nil {
+			return "", err
+		}
+
+		after, err := readMetaPages(path)
+		if err != nil {
+			_ = os.Remove(snapshot)
+			return "", err
+		}
+
+		if !bytes.Equal(before, after) {
+			lastErr = errors.New("it was written to while copying")
+			_ = os.Remove(snapshot)
+			continue
+		}
+
+		lastErr = checkDB(snapshot)
+		if lastErr == nil {
+			return snapshot, nil
+		}
+
+		_ = os.Remove(snapshot)
+	}
+
+	return "", fmt.Errorf("couldn't get a consistent snapshot of %s: %v", path, lastErr)
+}
+
+// the two pages at the start of a bbolt file, every commit ends by writing one of them
+func readMetaPages(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// the page size is in the meta, after the 16 byte page header, the magic and the version
+	header := make([]byte, 28)
+	_, err = io.ReadFull(f, header)
+	if err != nil {
+		return nil, err
+	}
+
+	pageSize := int(binary.LittleEndian.Uint32(header[24:]))
+	if pageSize < 512 || pageSize > 1<<16 || pageSize&(pageSize-1) != 0 {
+		pageSize = os.Getpagesize()
+	}
+
+	pages := make([]byte, 2*pageSize)
+	n, err := f.ReadAt(pages, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return pages[:n], nil
+}
+
+func copyToTemp(path string) (string, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	out, err := ioutil.TempFile("", filepath.Base(path)+".snapshot")
+	if err != nil {
+		return "", err
+	}
+
+	_, err = io.Copy(out, in)
+	if e := out.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		_ = os.Remove(out.Name())
+		return "", err
+	}
+
+	return out.Name(), nil
+}
+
+func checkDB(path string) (err error) {
+	// a torn copy can make bbolt panic rather than return an error
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	db, err := bbolt.Open(path, 0644, &bbolt.Options{ReadOnly: true, Timeout: lockTimeout})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.View(func(tx *bbolt.Tx) error {
+		var first error
+		// Check only finishes once all its errors are read
+		for err := range tx.Check() {
+			if first == nil {
+				first = err
+			}
+		}
+		return first
+	})
+}
+
+// non-nil if this is a snapshot because another tumtum holds the db
+func (s *Database) LockedBy() *LockedError {
+	if len(s.snapshot) == 0 {
+		return nil
+	}
+	return s.locked
+}
+
+// fails with a *LockedError if anyone has the db at path open
+func ensureUnlocked(path string) error {
+	db, err := bbolt.Open(path, 0644, &bbolt.Options{Timeout: lockTimeout})
+	if err == bbolt.ErrTimeout {
+		return newLockedError(path)
+	}
+	if err != nil {
+		return err
+	}
+	return db.Close()
+}
@@ -0,0 +1,322 @@
+package database
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"unicode/utf8"
+
+	"go.etcd.io/bbolt"
+)
+
+// everything tumtum stores is text, which is what lets dumps be plain JSON:
+// a bucket is an object, its values are strings and its nested buckets are objects
+type bucketDump map[string]interface{}
+
+// writes a consistent copy of the db to path, works on read only dbs too
+// a snapshot is only copied if the live db is still busy, a read transaction on that is consistent by definition
+func (s *Database) Backup(path string) (int64, error) {
+	if locked := s.LockedBy(); locked != nil {
+		live, err := bbolt.Open(locked.Path, 0644, &bbolt.Options{ReadOnly: true, Timeout: lockTimeout})
+		if err == nil {
+			defer live.Close()
+			return backup(live, path)
+		}
+	}
+
+	return backup(s.get(), path)
+}
+
+func backup(db *bbolt.DB, path string) (int64, error) {
+	var n int64
+
+	err := writeFileAtomic(path, func(w io.Writer) error {
+		return db.View(func(tx *bbolt.Tx) (err error) {
+			n, err = tx.WriteTo(w)
+			return
+		})
+	})
+
+	return n, err
+}
+
+// writes every bucket as JSON
+func (s *Database) Dump(w io.Writer) error {
+	root := bucketDump{}
+
+	err := s.get().View(func(tx *bbolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bbolt.Bucket) error {
+			d, err := dumpBucket(b)
+			if err != nil {
+				return fmt.Errorf("%s: %v", name, err)
+			}
+			root[string(name)] = d
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(root)
+}
+
+func dumpBucket(b *bbolt.Bucket) (bucketDump, error) {
+	d := bucketDump{}
+
+	err := b.ForEach(func(k, v []byte) error {
+		if !utf8.Valid(k) {
+			return fmt.Errorf("key %x isn't text", k)
+		}
+
+		// nil values are nested buckets
+		if v == nil {
+			nested, err := dumpBucket(b.Bucket(k))
+			if err != nil {
+				return fmt.Errorf("%s: %v", k, err)
+			}
+			d[string(k)] = nested
+			return nil
+		}
+
+		if !utf8.Valid(v) {
+			return fmt.Errorf("value of %s isn't text", k)
+		}
+		d[string(k)] = string(v)
+		return nil
+	})
+
+	return d, err
+}
+
+// rewrites the db at path without its free pages
+// fails with a *LockedError if anyone has the db open
+func Compact(path string) (before, after int64, err error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	before = fi.Size()
+
+	// the exclusive lock, held until the copy is renamed over path, since anyone who has the old file open
+	// would keep on using it after that, and whatever a scrape wrote to it would be lost
+	src, err := bbolt.Open(path, 0644, &bbolt.Options{Timeout: lockTimeout})
+	if err == bbolt.ErrTimeout {
+		return 0, 0, newLockedError(path)
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	defer src.Close()
+
+	err = replaceDB(path, func(dst *bbolt.DB) error {
+		return src.View(func(stx *bbolt.Tx) error {
+			return dst.Update(func(dtx *bbolt.Tx) error {
+				return stx.ForEach(func(name []byte, b *bbolt.Bucket) error {
+					nb, err := dtx.CreateBucket(name)
+					if err != nil {
+						return err
+					}
+					return copyBucket(nb, b)
+				})
+			})
+		})
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	fi, err = os.Stat(path)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return before, fi.Size(), nil
+}
+
+func copyBucket(dst, src *bbolt.Bucket) error {
+	return src.ForEach(func(k, v []byte) error {
+		if v == nil {
+			nb, err := dst.CreateBucket(k)
+			if err != nil {
+				return err
+			}
+			return copyBucket(nb, src.Bucket(k))
+		}
+		return dst.Put(k, v)
+	})
+}
+
+// replaces the db at path with a dump made by Dump, or a copy made by Backup
+// the db mustn't be open while this runs, the old one is kept as path.bak
+func Restore(path string, from string) error {
+	err := ensureUnlocked(path)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	first, err := r.Peek(1)
+	if err != nil {
+		return err
+	}
+
+	// not a dump, so hopefully a backup
+	if first[0] != '{' {
+		check, err := bbolt.Open(from, 0644, &bbolt.Options{ReadOnly: true})
+		if err != nil {
+			return fmt.Errorf("%s is neither a dump nor a backup: %v", from, err)
+		}
+		_ = check.Close()
+
+		return keepBackup(path, func() error {
+			return writeFileAtomic(path, func(w io.Writer) error {
+				_, err := io.Copy(w, r)
+				return err
+			})
+		})
+	}
+
+	root := map[string]json.RawMessage{}
+	err = json.NewDecoder(r).Decode(&root)
+	if err != nil {
+		return err
+	}
+
+	return keepBackup(path, func() error {
+		return replaceDB(path, func(db *bbolt.DB) error {
+			return db.Update(func(tx *bbolt.Tx) error {
+				for name, raw := range root {
+					b, err := tx.CreateBucket([]byte(name))
+					if err != nil {
+						return err
+					}
+
+					err = restoreBucket(b, raw)
+					if err != nil {
+						return fmt.Errorf("%s: %v", name, err)
+					}
+				}
+				return nil
+			})
+		})
+	})
+}
+
+func restoreBucket(b *bbolt.Bucket, raw json.RawMessage) error {
+	entries := map[string]json.RawMessage{}
+	err := json.Unmarshal(raw, &entries)
+	if err != nil {
+		return err
+	}
+
+	for k, v := range entries {
+		var s string
+		if json.Unmarshal(v, &s) == nil {
+			err = b.Put([]byte(k), []byte(s))
+		} else {
+			var nb *bbolt.Bucket
+			nb, err = b.CreateBucket([]byte(k))
+			if err == nil {
+				err = restoreBucket(nb, v)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", k, err)
+		}
+	}
+
+	return nil
+}
+
+// fill gets a fresh db that's then renamed over path
+func replaceDB(path string, fill func(db *bbolt.DB) error) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	_ = tmp.Close()
+
+	err = os.Chmod(tmp.Name(), 0644)
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+
+	db, err := bbolt.Open(tmp.Name(), 0644, nil)
+	if err == nil {
+		err = fill(db)
+		if e := db.Close(); err == nil {
+			err = e
+		}
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+func keepBackup(path string, replace func() error) error {
+	err := copyFile(path, path+".bak")
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return replace()
+}
+
+func writeFileAtomic(path string, write func(w io.Writer) error) error {
+	if len(path) == 0 {
+		return errors.New("missing path")
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+
+	err = write(f)
+	if err == nil {
+		err = f.Sync()
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), 0644)
+	}
+	if err != nil {
+		_ = os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	return writeFileAtomic(dst, func(w io.Writer) error {
+		_, err := io.Copy(w, in)
+		return err
+	})
+}
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func tempDB(t *testing.T) (path string, cleanup func()) {
+	dir, err := ioutil.TempDir("", "tumtum-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "tumtum.db"), func() { os.RemoveAll(dir) }
+}
+
+func TestCompactWhileOpen(t *testing.T) {
+	path, cleanup := tempDB(t)
+	defer cleanup()
+
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = Compact(path)
+	if _, ok := err.(*LockedError); !ok {
+		t.Errorf("compacting a db that's being scraped into gave %v, want a LockedError", err)
+	}
+
+	cursor := time.Unix(1500000000, 0)
+	err = db.SetTime("someblog.tumblr.com", cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	_, _, err = Compact(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err = NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if got, _ := db.GetTime("someblog.tumblr.com"); !got.Equal(cursor) {
+		t.Errorf("cursor is %v after compacting, want %v", got, cursor)
+	}
+}
+
+func TestBackupPrefersLiveDB(t *testing.T) {
+	path, cleanup := tempDB(t)
+	defer cleanup()
+
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = db.SetTime("first.tumblr.com", time.Unix(1500000000, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ro, err := OpenReadOnly(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ro.Close()
+
+	if ro.LockedBy() == nil {
+		t.Fatal("expected a snapshot while the db is held")
+	}
+
+	// only in the live db
+	err = db.SetTime("second.tumblr.com", time.Unix(1500000000, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the writer still holds the db, so all there is to back up is the snapshot
+	held := filepath.Join(filepath.Dir(path), "held.db")
+	_, err = ro.Backup(held)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db.Close()
+
+	free := filepath.Join(filepath.Dir(path), "free.db")
+	_, err = ro.Backup(free)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for backup, want := range map[string]bool{held: false, free: true} {
+		b, err := OpenReadOnly(backup)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, _ := b.GetTime("second.tumblr.com")
+		if !got.IsZero() != want {
+			t.Errorf("%s has the write after the snapshot: %v, want %v", filepath.Base(backup), !got.IsZero(), want)
+		}
+		b.Close()
+	}
+}
@@ -0,0 +1,147 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+
+	"go.etcd.io/bbolt"
+)
+
+var (
+	metaObj          = []byte("meta")
+	schemaVersionKey = []byte("schema_version")
+)
+
+// every migration takes the db from version i to i+1, so only ever append to this
+var migrations = []func(tx *bbolt.Tx) error{
+	// 0 -> 1: the original layout, a time and an offset bucket
+	func(tx *bbolt.Tx) error {
+		for _, name := range [][]byte{timeObj, offsetObj} {
+			_, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	// 1 -> 2: downloads that failed for good
+	func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(failedObj)
+		return err
+	},
+	// 2 -> 3: the posts that were already scraped, per blog
+	func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(postsObj)
+		return err
+	},
+	// 3 -> 4: what the api said about each blog
+	func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(blogsObj)
+		return err
+	},
+	// 4 -> 5: other names of blogs, e.g. from before a rename
+	func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(aliasesObj)
+		return err
+	},
+	// 5 -> 6: a cursor per blog instead of one for whatever blog was scraped last
+	migratePerBlogCursors,
+}
+
+// the old time and offset keys can't be told apart from the blog they were saved for, so they're kept under
+// legacyCursorKey until a blog without a cursor of its own adopts them, see AdoptLegacyCursor
+func migratePerBlogCursors(tx *bbolt.Tx) error {
+	for _, name := range [][]byte{timeObj, offsetObj} {
+		b, err := tx.CreateBucketIfNotExists(name)
+		if err != nil {
+			return err
+		}
+
+		old := b.Get(name)
+		if len(old) == 0 {
+			continue
+		}
+
+		err = b.Put(legacyCursorKey, append([]byte(nil), old...))
+		if err != nil {
+			return err
+		}
+
+		err = b.Delete(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// the version this build of tumtum writes
+func SchemaVersion() int {
+	return len(migrations)
+}
+
+// the version the db is at
+func (s *Database) SchemaVersion() (version int, err error) {
+	err = s.get().View(func(tx *bbolt.Tx) error {
+		version, err = schemaVersion(tx)
+		return err
+	})
+	return
+}
+
+func schemaVersion(tx *bbolt.Tx) (int, error) {
+	b := tx.Bucket(metaObj)
+	if b == nil {
+		// dbs from before versioning was a thing
+		return 0, nil
+	}
+
+	data := b.Get(schemaVersionKey)
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	return strconv.Atoi(string(data))
+}
+
+func setSchemaVersion(tx *bbolt.Tx, v int) error {
+	b, err := tx.CreateBucketIfNotExists(metaObj)
+	if err != nil {
+		return err
+	}
+
+	return b.Put(schemaVersionKey, []byte(strconv.Itoa(v)))
+}
+
+// runs every migration the db hasn't seen yet, each in its own transaction
+func migrate(db *bbolt.DB) error {
+	var version int
+
+	err := db.View(func(tx *bbolt.Tx) (err error) {
+		version, err = schemaVersion(tx)
+		return
+	})
+	if err != nil {
+		return err
+	}
+
+	if version > SchemaVersion() {
+		return fmt.Errorf("%s has schema version %d, but this tumtum only knows up to %d", db.Path(), version, SchemaVersion())
+	}
+
+	for ; version < SchemaVersion(); version++ {
+		err = db.Update(func(tx *bbolt.Tx) error {
+			err := migrations[version](tx)
+			if err != nil {
+				return err
+			}
+			return setSchemaVersion(tx, version+1)
+		})
+		if err != nil {
+			return fmt.Errorf("migrating %s to schema version %d: %v", db.Path(), version+1, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,123 @@
+package database
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// a db as tumtum left it at schema version 1, with a single cursor for whatever blog it scraped
+func writeV1DB(t *testing.T, path string, cursor time.Time, offset int64) {
+	db, err := bbolt.Open(path, 0644, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, kv := range []struct {
+			bucket, key, value string
+		}{
+			{"time", "time", strconv.FormatInt(cursor.Unix(), 10)},
+			{"offset", "offset", strconv.FormatInt(offset, 10)},
+			{"meta", "schema_version", "1"},
+		} {
+			b, err := tx.CreateBucketIfNotExists([]byte(kv.bucket))
+			if err != nil {
+				return err
+			}
+			err = b.Put([]byte(kv.key), []byte(kv.value))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateKeepsLegacyCursor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tumtum-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "tumtum.db")
+	cursor := time.Unix(1500000000, 0)
+	writeV1DB(t, path, cursor, 1234)
+
+	db, err := NewDB(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if v, err := db.SchemaVersion(); err != nil || v != SchemaVersion() {
+		t.Fatalf("schema version %d (%v), want %d", v, err, SchemaVersion())
+	}
+
+	legacy, found, err := db.LegacyCursor()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !found || !legacy.Time.Equal(cursor) || legacy.Offset != 1234 {
+		t.Fatalf("legacy cursor %+v (found %v), want %v and 1234", legacy, found, cursor)
+	}
+
+	cursors, err := db.Cursors()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cursors) != 0 {
+		t.Errorf("the legacy cursor shows up as a blog's: %v", cursors)
+	}
+
+	// a blog with a cursor of its own keeps it
+	own := time.Unix(1400000000, 0)
+	err = db.SetTime("other.tumblr.com", own)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, adopted, err := db.AdoptLegacyCursor("other.tumblr.com"); err != nil || adopted {
+		t.Fatalf("a blog with a cursor adopted the legacy one (%v)", err)
+	}
+	if got, _ := db.GetTime("other.tumblr.com"); !got.Equal(own) {
+		t.Errorf("cursor of other.tumblr.com is %v, want %v", got, own)
+	}
+
+	c, adopted, err := db.AdoptLegacyCursor("someblog.tumblr.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !adopted || !c.Time.Equal(cursor) {
+		t.Fatalf("adopted %+v (%v), want %v", c, adopted, cursor)
+	}
+
+	got, err := db.GetTime("someblog.tumblr.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset, err := db.GetOffset("someblog.tumblr.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(cursor) || offset != 1234 {
+		t.Errorf("cursor of someblog.tumblr.com is %v with offset %d, want %v and 1234", got, offset, cursor)
+	}
+
+	// it's only adopted once
+	if _, found, _ := db.LegacyCursor(); found {
+		t.Error("the legacy cursor is still there after being adopted")
+	}
+	if _, adopted, _ := db.AdoptLegacyCursor("third.tumblr.com"); adopted {
+		t.Error("the legacy cursor was adopted twice")
+	}
+}
@@ -0,0 +1,75 @@
+package database
+
+import (
+	"strconv"
+
+	"go.etcd.io/bbolt"
+)
+
+// every post that was scraped, in a bucket per blog, with a hash of its content
+var postsObj = []byte("posts")
+
+// returns the hash a post had when it was last scraped, or false if it never was
+func (s *Database) PostHash(blog string, id int64) (string, bool, error) {
+	var (
+		hash  string
+		found bool
+	)
+
+	err := s.get().View(func(tx *bbolt.Tx) error {
+		b := postsBucket(tx, blog)
+		if b == nil {
+			return nil
+		}
+
+		data := b.Get([]byte(strconv.FormatInt(id, 10)))
+		if data == nil {
+			return nil
+		}
+
+		hash, found = string(data), true
+		return nil
+	})
+
+	return hash, found, err
+}
+
+// records that a post was scraped
+// called from many goroutines at once, so the writes are batched
+func (s *Database) MarkPost(blog string, id int64, hash string) error {
+	return s.get().Batch(func(tx *bbolt.Tx) error {
+		posts, err := tx.CreateBucketIfNotExists(postsObj)
+		if err != nil {
+			return err
+		}
+
+		b, err := posts.CreateBucketIfNotExists([]byte(blog))
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(strconv.FormatInt(id, 10)), []byte(hash))
+	})
+}
+
+// how many posts of a blog were scraped
+func (s *Database) PostCount(blog string) (int, error) {
+	var n int
+
+	err := s.get().View(func(tx *bbolt.Tx) error {
+		if b := postsBucket(tx, blog); b != nil {
+			n = b.Stats().KeyN
+		}
+		return nil
+	})
+
+	return n, err
+}
+
+func postsBucket(tx *bbolt.Tx, blog string) *bbolt.Bucket {
+	posts := tx.Bucket(postsObj)
+	if posts == nil {
+		return nil
+	}
+	return posts.Bucket([]byte(blog))
+}
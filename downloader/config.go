@@ -0,0 +1,43 @@
+package downloader
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/soeux/tumtum/config"
+	"github.com/urfave/cli/v2"
+)
+
+// writes a default tumtum.toml to wherever --config points
+func HandleConfigInit(c *cli.Context) error {
+	path := configPath(c)
+
+	err := config.WriteDefault(path, c.Bool("force"))
+	if err != nil {
+		return err
+	}
+
+	log.Printf("wrote %s, don't forget to set api_key", path)
+	return nil
+}
+
+// prints the config tumtum would actually use, after the environment and flags are applied
+func HandleConfigShow(c *cli.Context) error {
+	cfg, err := config.Load(configPath(c))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("# %s\n", configPath(c))
+
+	// still show what we've got if it's invalid, that's usually why someone's looking
+	verr := applyFlags(c, cfg)
+
+	err = cfg.Show(os.Stdout)
+	if err != nil {
+		return err
+	}
+
+	return verr
+}
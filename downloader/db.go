@@ -0,0 +1,200 @@
+package downloader
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/soeux/tumtum/database"
+	"github.com/urfave/cli/v2"
+)
+
+// copies tumtum.db while it's in use
+func HandleDBBackup(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return errors.New("usage: tumtum db backup FILE")
+	}
+
+	db, err := openReadOnly(c)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	n, err := db.Backup(c.Args().First())
+	if err != nil {
+		return err
+	}
+
+	log.Printf("backed up %s to %s (%d bytes)", dbPath(c), c.Args().First(), n)
+	return nil
+}
+
+// tumtum.db never shrinks on its own
+func HandleDBCompact(c *cli.Context) error {
+	before, after, err := database.Compact(dbPath(c))
+	if err != nil {
+		return err
+	}
+
+	log.Printf("compacted %s from %d to %d bytes", dbPath(c), before, after)
+	return nil
+}
+
+// writes tumtum.db as JSON to FILE, or stdout
+func HandleDBDump(c *cli.Context) error {
+	db, err := openReadOnly(c)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if c.NArg() == 0 {
+		return db.Dump(os.Stdout)
+	}
+
+	f, err := os.Create(c.Args().First())
+	if err != nil {
+		return err
+	}
+
+	err = db.Dump(f)
+	if e := f.Close(); err == nil {
+		err = e
+	}
+
+	return err
+}
+
+// replaces tumtum.db with a dump or a backup
+func HandleDBRestore(c *cli.Context) error {
+	if c.NArg() != 1 {
+		return errors.New("usage: tumtum db restore FILE")
+	}
+
+	err := database.Restore(dbPath(c), c.Args().First())
+	if err != nil {
+		return err
+	}
+
+	log.Printf("restored %s from %s, the old one was kept as %s.bak", dbPath(c), c.Args().First(), dbPath(c))
+	return nil
+}
+
+// prints what's in tumtum.db, works while a scrape is running
+func HandleStatus(c *cli.Context) error {
+	db, err := openReadOnly(c)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	version, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("db:             %s (schema version %d)\n", dbPath(c), version)
+
+	if locked := db.LockedBy(); locked != nil {
+		fmt.Printf("in use:         %v\n", locked)
+	}
+
+	cursors, err := db.Cursors()
+	if err != nil {
+		return err
+	}
+
+	legacy, hasLegacy, err := db.LegacyCursor()
+	if err != nil {
+		return err
+	}
+
+	if len(cursors) == 0 && !hasLegacy {
+		fmt.Println("cursor:         none, the next scrape starts from the newest post")
+	}
+
+	if hasLegacy && legacy.Time.IsZero() {
+		fmt.Printf("cursor:         from an older tumtum at the newest post, %d posts seen, for the next blog scraped without one\n", legacy.Offset)
+	} else if hasLegacy {
+		fmt.Printf("cursor:         from an older tumtum at %v, %d posts seen, for the next blog scraped without one\n", legacy.Time.Format("2Jan06 15:04:05"), legacy.Offset)
+	}
+
+	names := make([]string, 0, len(cursors))
+	for name := range cursors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		cursor := cursors[name]
+		if cursor.Time.IsZero() {
+			fmt.Printf("cursor:         %s at the newest post, %d posts seen\n", name, cursor.Offset)
+		} else {
+			fmt.Printf("cursor:         %s at %v, %d posts seen\n", name, cursor.Time.Format("2Jan06 15:04:05"), cursor.Offset)
+		}
+	}
+
+	failures, err := db.Failures()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("failed files:   %d\n", len(failures))
+
+	blogs, err := db.Blogs()
+	if err != nil {
+		return err
+	}
+
+	names = names[:0]
+	for name := range blogs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		info := blogs[name]
+
+		scraped, err := db.PostCount(name)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("blog:           %s (%q), %d of %d posts scraped, last updated %v\n", name, info.Title, scraped, info.Posts, time.Unix(info.Updated, 0).Format("2Jan06 15:04:05"))
+	}
+
+	aliases, err := db.Aliases()
+	if err != nil {
+		return err
+	}
+
+	names = names[:0]
+	for alias := range aliases {
+		names = append(names, alias)
+	}
+	sort.Strings(names)
+
+	for _, alias := range names {
+		fmt.Printf("alias:          %s -> %s\n", alias, aliases[alias])
+	}
+
+	return nil
+}
+
+// logs when we're looking at a snapshot, so nobody's surprised by slightly old data
+func openReadOnly(c *cli.Context) (*database.Database, error) {
+	db, err := database.OpenReadOnly(dbPath(c))
+	if err != nil {
+		return nil, err
+	}
+
+	if locked := db.LockedBy(); locked != nil {
+		log.Printf("%v, reading a snapshot", locked)
+	}
+
+	return db, nil
+}
@@ -2,15 +2,20 @@ package downloader
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
+	"regexp"
+	"strconv"
 	"syscall"
 	"time"
 
+	"github.com/soeux/tumtum/blogid"
 	"github.com/soeux/tumtum/config"
 	"github.com/soeux/tumtum/database"
 	"github.com/soeux/tumtum/scraper"
@@ -18,25 +23,67 @@ import (
 )
 
 // gets everything started
-func HandleLink(c *cli.Context, url string) error {
-	// creating parentContext
-	ctx := parentContext()
+func HandleLink(c *cli.Context, id blogid.Identifier) error {
+	if id.PostID != 0 {
+		log.Printf("%s: scraping the whole blog, not just post %d", id.Blog, id.PostID)
+	}
+
+	return runScraper(c, func(ctx context.Context, s *scraper.Scraper, cfg *config.Config, opts *scraper.Options) error {
+		// the scraper saves its own pagination state
+		return s.Scrape(ctx, id.Blog, cfg, opts)
+	})
+}
 
-	cfg, err := config.LoadConfigOrDefault("tumtum.toml")
+// the setup every command that scrapes shares: config, signals, db, options and the export file
+// fn does the scraping, after which hooks and webhooks get to finish
+func runScraper(c *cli.Context, fn func(ctx context.Context, s *scraper.Scraper, cfg *config.Config, opts *scraper.Options) error) (err error) {
+	cfg, err := loadConfig(c)
 	if err != nil {
 		return err
 	}
 
-	db, err := database.NewDB()
+	// creating parentContext
+	ctx, stopping := parentContext(cfg.Drain())
+
+	db, err := database.NewDB(dbPath(c))
 	if err != nil {
 		return err
 	}
+	defer db.Close()
 
 	httpClient := newHTTPClient() // newHTTPClient(jar)
 
+	opts, err := scrapeOptions(c)
+	if err != nil {
+		return err
+	}
+	opts.Stop = stopping
+
+	if c.IsSet("export") {
+		f, err := os.Create(c.String("export"))
+		if err != nil {
+			return err
+		}
+		// a full disk can show up as late as this
+		defer func() {
+			if e := f.Close(); err == nil {
+				err = e
+			}
+		}()
+
+		opts.Plan = f
+	}
+
 	s := scraper.NewScraper(httpClient, cfg, db)
 
-	times, offsets, err := s.Scrape(ctx, url, cfg)
+	stopControlSignals := handleControlSignals(s)
+	defer stopControlSignals()
+
+	s.Start(opts)
+
+	err = fn(ctx, s, cfg, opts)
+	// runs the run-done hooks, sends the run-finished webhook and waits for both
+	err = s.Finish(ctx, opts, err)
 	if err != nil {
 		if !isContextCanceledError(err) {
 			log.Println(err)
@@ -44,34 +91,216 @@ func HandleLink(c *cli.Context, url string) error {
 		return err
 	}
 
-	err = db.SetTime(times)
+	return nil
+}
+
+// tumtum.toml, then the environment, then the flags, validated and ready to download to save_location
+func loadConfig(c *cli.Context) (*config.Config, error) {
+	cfg, err := config.Load(configPath(c))
 	if err != nil {
-		log.Println(err)
-		return err
+		return nil, err
 	}
 
-	err = db.SetOffset(offsets)
+	err = applyFlags(c, cfg)
 	if err != nil {
-		log.Println(err)
+		return nil, err
 	}
 
-	return nil
+	err = cfg.CheckSave()
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// --config, then $TUMTUM_CONFIG, then the default locations
+func configPath(c *cli.Context) string {
+	if p := c.String("config"); len(p) != 0 {
+		return p
+	}
+	return config.DefaultPath()
 }
 
-func parentContext() context.Context {
+// --db, then $TUMTUM_DB, then the default locations
+func dbPath(c *cli.Context) string {
+	if p := c.String("db"); len(p) != 0 {
+		return p
+	}
+	return config.DefaultDBPath()
+}
+
+// command line flags take precedence over tumtum.toml, only the values are validated
+func applyFlags(c *cli.Context, cfg *config.Config) error {
+	if c.Bool("original-only") && c.Bool("reblogs-only") {
+		return errors.New("--original-only and --reblogs-only are mutually exclusive")
+	}
+
+	if c.Bool("original-only") {
+		cfg.Posts = config.PostsOriginal
+	}
+	if c.Bool("reblogs-only") {
+		cfg.Posts = config.PostsReblogs
+	}
+	if c.IsSet("root-blog") {
+		cfg.RootBlogs = c.StringSlice("root-blog")
+	}
+	if c.IsSet("media-kind") {
+		cfg.MediaKinds = c.StringSlice("media-kind")
+	}
+	if c.IsSet("min-width") {
+		cfg.MinWidth = c.Int("min-width")
+	}
+	if c.IsSet("min-height") {
+		cfg.MinHeight = c.Int("min-height")
+	}
+	if c.IsSet("max-file-size") {
+		cfg.MaxFileSize = c.Int64("max-file-size")
+	}
+	if c.IsSet("mime-allow") {
+		cfg.MIMEAllow = c.StringSlice("mime-allow")
+	}
+	if c.IsSet("mime-deny") {
+		cfg.MIMEDeny = c.StringSlice("mime-deny")
+	}
+	if c.IsSet("allow-webp") {
+		cfg.AllowWebP = c.Bool("allow-webp")
+	}
+	if c.IsSet("reprocess-changed") {
+		cfg.ReprocessChanged = c.Bool("reprocess-changed")
+	}
+
+	return cfg.Validate()
+}
+
+func scrapeOptions(c *cli.Context) (*scraper.Options, error) {
+	opts := &scraper.Options{}
+	now := time.Now()
+
+	var err error
+
+	if c.IsSet("since") {
+		opts.Since, err = parseTimeBound(c.String("since"), now)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --since: %v", err)
+		}
+	}
+
+	if c.IsSet("until") {
+		opts.Until, err = parseTimeBound(c.String("until"), now)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --until: %v", err)
+		}
+	}
+
+	if !opts.Since.IsZero() && !opts.Until.IsZero() && !opts.Since.Before(opts.Until) {
+		return nil, errors.New("--since must be before --until")
+	}
+
+	opts.Sync = c.Bool("sync")
+	if opts.Sync && !opts.Until.IsZero() {
+		return nil, errors.New("--sync always starts at the newest post, so it can't be combined with --until")
+	}
+
+	if c.Bool("dry-run") && c.IsSet("export") {
+		return nil, errors.New("--dry-run and --export are mutually exclusive")
+	}
+
+	if c.Bool("dry-run") {
+		opts.Plan = os.Stdout
+		opts.PlanFormat = c.String("format")
+		opts.Estimate = c.Bool("estimate")
+	}
+
+	// the file itself gets opened by the handlers
+	if c.IsSet("export") {
+		opts.PlanFormat = scraper.PlanAria2
+		if c.IsSet("format") {
+			opts.PlanFormat = c.String("format")
+		}
+		opts.Estimate = c.Bool("estimate")
+	}
+
+	return opts, nil
+}
+
+var (
+	timeBoundLayouts = []string{
+		time.RFC3339,
+		"2006-01-02T15:04:05",
+		"2006-01-02 15:04:05",
+		"2006-01-02",
+	}
+
+	// time.ParseDuration doesn't know about days or weeks
+	timeBoundDurationRegexp = regexp.MustCompile(`^(\d+)([dw])$`)
+)
+
+// accepts either an absolute date or a duration like 30d, which is taken as that long before now
+func parseTimeBound(s string, now time.Time) (time.Time, error) {
+	for _, layout := range timeBoundLayouts {
+		t, err := time.ParseInLocation(layout, s, time.Local)
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	if m := timeBoundDurationRegexp.FindStringSubmatch(s); m != nil {
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return time.Time{}, err
+		}
+
+		days := n
+		if m[2] == "w" {
+			days *= 7
+		}
+
+		return now.AddDate(0, 0, -days), nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is neither a date nor a duration", s)
+	}
+
+	return now.Add(-d), nil
+}
+
+// shutting down happens in two stages:
+// the first signal closes stopping, so no new pages are fetched and no new downloads are queued,
+// the second one, or drain running out, cancels ctx and with it the downloads still in flight
+func parentContext(drain time.Duration) (ctx context.Context, stopping <-chan struct{}) {
 	ctx, cancel := context.WithCancel(context.Background())
+	stop := make(chan struct{})
 
 	go func() {
 		defer cancel()
 
-		ch := make(chan os.Signal, 1)
+		ch := make(chan os.Signal, 2)
 		signal.Notify(ch, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM)
 		defer signal.Stop(ch)
 
 		<-ch
+		close(stop)
+
+		var timeout <-chan time.Time
+		if drain > 0 {
+			log.Printf("finishing downloads in progress for up to %v, send another signal to stop right away", drain)
+			timeout = time.After(drain)
+		} else {
+			log.Print("finishing downloads in progress, send another signal to stop right away")
+		}
+
+		select {
+		case <-ch:
+			log.Print("stopping right away")
+		case <-timeout:
+			log.Print("ran out of time to finish downloads, stopping")
+		}
 	}()
 
-	return ctx
+	return ctx, stop
 }
 
 // func newHTTPClient(jar *cookiejar.Jar) *http.Client {
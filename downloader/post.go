@@ -0,0 +1,76 @@
+package downloader
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/soeux/tumtum/blogid"
+	"github.com/soeux/tumtum/config"
+	"github.com/soeux/tumtum/scraper"
+	"github.com/urfave/cli/v2"
+)
+
+// downloads single posts given as arguments or listed in --file
+func HandlePost(c *cli.Context) error {
+	links := c.Args().Slice()
+
+	if c.IsSet("file") {
+		l, err := readLinks(c.String("file"))
+		if err != nil {
+			return err
+		}
+		links = append(links, l...)
+	}
+
+	if len(links) == 0 {
+		return errors.New("usage: tumtum post URL... or tumtum post --file FILE")
+	}
+
+	// check all of them before downloading anything
+	posts := make([]blogid.Identifier, 0, len(links))
+	for _, link := range links {
+		id, err := blogid.Parse(link)
+		if err != nil {
+			return err
+		}
+		if id.PostID == 0 {
+			return fmt.Errorf("%s is not a link to a post", link)
+		}
+		posts = append(posts, id)
+	}
+
+	return runScraper(c, func(ctx context.Context, s *scraper.Scraper, cfg *config.Config, opts *scraper.Options) error {
+		return s.ScrapePosts(ctx, posts, cfg, opts)
+	})
+}
+
+// one link per line, blank lines and lines starting with # are skipped, - reads stdin
+func readLinks(path string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		r = f
+	}
+
+	var links []string
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		links = append(links, line)
+	}
+
+	return links, s.Err()
+}
@@ -0,0 +1,47 @@
+//go:build !windows
+// +build !windows
+
+package downloader
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/soeux/tumtum/scraper"
+)
+
+// SIGUSR1 prints a status snapshot, SIGUSR2 pauses or resumes the scraper
+// the returned func stops listening
+func handleControlSignals(s *scraper.Scraper) func() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	done := make(chan struct{})
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case sig := <-ch:
+				switch sig {
+				case syscall.SIGUSR1:
+					s.Status(os.Stderr)
+				case syscall.SIGUSR2:
+					if s.TogglePause() {
+						log.Print("paused, send SIGUSR2 again to resume")
+					} else {
+						log.Print("resumed")
+					}
+				}
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
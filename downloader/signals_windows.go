@@ -0,0 +1,11 @@
+//go:build windows
+// +build windows
+
+package downloader
+
+import "github.com/soeux/tumtum/scraper"
+
+// there's no SIGUSR1 or SIGUSR2 on windows
+func handleControlSignals(s *scraper.Scraper) func() {
+	return func() {}
+}
@@ -0,0 +1,135 @@
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/soeux/tumtum/config"
+)
+
+// what an event is about, passed to commands with a TUMTUM_ prefix, e.g. "PATH" becomes $TUMTUM_PATH
+type Env map[string]string
+
+// runs the commands of config.Hook in the background, no more than hook_concurrency at once
+type Runner struct {
+	hooks map[string][]config.Hook
+	sema  chan struct{}
+	wg    sync.WaitGroup
+
+	// the first failure of a hook that aborts
+	lock sync.Mutex
+	err  error
+}
+
+// cfg has to be validated
+func New(cfg *config.Config) *Runner {
+	r := &Runner{
+		hooks: make(map[string][]config.Hook),
+	}
+
+	for _, h := range cfg.Hooks {
+		r.hooks[h.Event] = append(r.hooks[h.Event], h)
+	}
+
+	if len(cfg.Hooks) != 0 {
+		r.sema = make(chan struct{}, cfg.HookConcurrency)
+	}
+
+	return r
+}
+
+// whether anything runs on event, so callers can skip putting together its Env
+func (r *Runner) Has(event string) bool {
+	return len(r.hooks[event]) != 0
+}
+
+// starts the commands for event, blocking while hook_concurrency of them are running already
+// once ctx is canceled they're killed, and no new ones start
+func (r *Runner) Fire(ctx context.Context, event string, env Env) {
+	for _, h := range r.hooks[event] {
+		select {
+		case r.sema <- struct{}{}:
+		case <-ctx.Done():
+			return
+		}
+
+		r.wg.Add(1)
+		go func(h config.Hook) {
+			defer r.wg.Done()
+			defer func() { <-r.sema }()
+
+			err := run(ctx, h, env)
+			if err == nil {
+				return
+			}
+
+			log.Printf("hook %q for %s failed: %v", h.Command[0], event, err)
+
+			if h.OnFailure == config.HookFailureAbort {
+				r.lock.Lock()
+				if r.err == nil {
+					r.err = fmt.Errorf("hook %q for %s failed: %w", h.Command[0], event, err)
+				}
+				r.lock.Unlock()
+			}
+		}(h)
+	}
+}
+
+// the failure of a hook that aborts, if there was one
+func (r *Runner) Err() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.err
+}
+
+// waits for the commands that are still running, see Err
+func (r *Runner) Wait() error {
+	r.wg.Wait()
+	return r.Err()
+}
+
+func run(ctx context.Context, h config.Hook, env Env) error {
+	if d := h.TimeoutDuration(); d > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, h.Command[0], h.Command[1:]...)
+	// stdout is for dry runs, and hooks don't run during those anyway
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+
+	cmd.Env = append(environ(), "TUMTUM_EVENT="+h.Event)
+	for k, v := range env {
+		cmd.Env = append(cmd.Env, "TUMTUM_"+k+"="+v)
+	}
+
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %s", h.Timeout)
+	}
+
+	return err
+}
+
+// tumtum's own environment, without the config overrides, which have no business in hooks, TUMTUM_API_KEY least of all
+func environ() []string {
+	overrides := config.EnvOverrides()
+
+	var env []string
+	for _, kv := range os.Environ() {
+		if !overrides[strings.SplitN(kv, "=", 2)[0]] {
+			env = append(env, kv)
+		}
+	}
+
+	return env
+}
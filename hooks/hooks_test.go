@@ -0,0 +1,77 @@
+package hooks
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/soeux/tumtum/config"
+)
+
+func TestEnvironment(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tumtum-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	vars := map[string]string{
+		"TUMTUM_API_KEY":       "hunter2",
+		"TUMTUM_SAVE_LOCATION": dir,
+		"TUMTUM_TEST_KEPT":     "kept",
+	}
+	for k, v := range vars {
+		os.Setenv(k, v)
+	}
+	defer func() {
+		for k := range vars {
+			os.Unsetenv(k)
+		}
+	}()
+
+	out := filepath.Join(dir, "env")
+	r := New(&config.Config{
+		HookConcurrency: 1,
+		Hooks: []config.Hook{{
+			Event:   config.HookFileWritten,
+			Command: []string{"sh", "-c", "env > " + out},
+			Timeout: "1m",
+		}},
+	})
+
+	r.Fire(context.Background(), config.HookFileWritten, Env{"PATH": "/save/a.jpg"})
+	err = r.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		if kv := strings.SplitN(line, "=", 2); len(kv) == 2 {
+			env[kv[0]] = kv[1]
+		}
+	}
+
+	for _, k := range []string{"TUMTUM_API_KEY", "TUMTUM_SAVE_LOCATION"} {
+		if v, ok := env[k]; ok {
+			t.Errorf("the hook got %s=%s", k, v)
+		}
+	}
+	for k, want := range map[string]string{
+		"TUMTUM_TEST_KEPT": "kept",
+		"TUMTUM_EVENT":     config.HookFileWritten,
+		"TUMTUM_PATH":      "/save/a.jpg",
+	} {
+		if env[k] != want {
+			t.Errorf("%s is %q, want %q", k, env[k], want)
+		}
+	}
+}
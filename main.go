@@ -2,10 +2,11 @@ package main
 
 import (
     "os"
+    "errors"
     "fmt"
     "time"
-    "strings"
     "github.com/urfave/cli/v2"
+    "github.com/soeux/tumtum/blogid"
     "github.com/soeux/tumtum/downloader"
 )
 
@@ -22,24 +23,173 @@ func main() {
                 Name: "download",
                 Aliases: []string{"d"},
                 Usage: "downloads from blog `URL`",
-                Required: true,
                 Destination: &blogURL,
             },
+            &cli.StringFlag {
+                Name: "config",
+                Usage: "load settings from `FILE` (default: ./tumtum.toml or $XDG_CONFIG_HOME/tumtum/tumtum.toml)",
+                EnvVars: []string{"TUMTUM_CONFIG"},
+            },
+            &cli.StringFlag {
+                Name: "db",
+                Usage: "keep scraping progress in `FILE` (default: ./tumtum.db or $XDG_DATA_HOME/tumtum/tumtum.db)",
+                EnvVars: []string{"TUMTUM_DB"},
+            },
+            &cli.BoolFlag {
+                Name: "original-only",
+                Usage: "only scrape original posts, skipping reblogs",
+            },
+            &cli.BoolFlag {
+                Name: "reblogs-only",
+                Usage: "only scrape reblogs, skipping original posts",
+            },
+            &cli.StringSliceFlag {
+                Name: "root-blog",
+                Usage: "only scrape media reblogged from blog `NAME` (can be repeated)",
+            },
+            &cli.StringSliceFlag {
+                Name: "media-kind",
+                Usage: "only download media of `KIND` image, gif, video or audio (can be repeated)",
+            },
+            &cli.IntFlag {
+                Name: "min-width",
+                Usage: "skip images narrower than `PIXELS`",
+            },
+            &cli.IntFlag {
+                Name: "min-height",
+                Usage: "skip images shorter than `PIXELS`",
+            },
+            &cli.Int64Flag {
+                Name: "max-file-size",
+                Usage: "skip files larger than `BYTES`",
+            },
+            &cli.StringSliceFlag {
+                Name: "mime-allow",
+                Usage: "only download files of `TYPE`, e.g. video/mp4 or image/* (can be repeated)",
+            },
+            &cli.StringSliceFlag {
+                Name: "mime-deny",
+                Usage: "never download files of `TYPE`, e.g. image/webp (can be repeated)",
+            },
+            &cli.BoolFlag {
+                Name: "allow-webp",
+                Usage: "accept WebP in place of the original GIF, PNG or JPEG",
+            },
+            &cli.BoolFlag {
+                Name: "sync",
+                Usage: "scrape new posts from the top until reaching posts that were already scraped",
+            },
+            &cli.BoolFlag {
+                Name: "reprocess-changed",
+                Usage: "scrape posts again if they were edited since they were last scraped",
+            },
+            &cli.BoolFlag {
+                Name: "dry-run",
+                Usage: "list what would be downloaded to stdout instead of downloading it",
+            },
+            &cli.StringFlag {
+                Name: "export",
+                Usage: "write every media URL to `FILE` for another downloader instead of downloading it",
+            },
+            &cli.StringFlag {
+                Name: "format",
+                Usage: "dry run or export `FORMAT`: tsv, json, jsonl, txt or aria2 (default: tsv for dry runs, aria2 for exports)",
+            },
+            &cli.BoolFlag {
+                Name: "estimate",
+                Usage: "send HEAD requests during a dry run or export to find out how much would be downloaded",
+            },
+            &cli.StringFlag {
+                Name: "since",
+                Usage: "only scrape posts published after `DATE` (e.g. 2020-01-31 or 30d)",
+            },
+            &cli.StringFlag {
+                Name: "until",
+                Usage: "only scrape posts published before `DATE` (e.g. 2020-01-31 or 30d)",
+            },
+        },
+        Commands: []*cli.Command {
+            {
+                Name: "config",
+                Usage: "manage tumtum.toml",
+                Subcommands: []*cli.Command {
+                    {
+                        Name: "init",
+                        Usage: "write a commented default config",
+                        Flags: []cli.Flag {
+                            &cli.BoolFlag {
+                                Name: "force",
+                                Usage: "overwrite an existing config, keeping it as .bak",
+                            },
+                        },
+                        Action: downloader.HandleConfigInit,
+                    },
+                    {
+                        Name: "show",
+                        Usage: "print the effective config with secrets masked",
+                        Action: downloader.HandleConfigShow,
+                    },
+                },
+            },
+            {
+                Name: "post",
+                Usage: "download single posts without touching the saved progress of their blogs",
+                ArgsUsage: "URL...",
+                Flags: []cli.Flag {
+                    &cli.StringFlag {
+                        Name: "file",
+                        Usage: "also download the posts linked in `FILE`, one per line (- for stdin)",
+                    },
+                },
+                Action: downloader.HandlePost,
+            },
+            {
+                Name: "status",
+                Usage: "show the scraping progress saved in tumtum.db, even while tumtum is running",
+                Action: downloader.HandleStatus,
+            },
+            {
+                Name: "db",
+                Usage: "maintain tumtum.db",
+                Subcommands: []*cli.Command {
+                    {
+                        Name: "backup",
+                        Usage: "copy the db to `FILE`, even while tumtum is running",
+                        ArgsUsage: "FILE",
+                        Action: downloader.HandleDBBackup,
+                    },
+                    {
+                        Name: "compact",
+                        Usage: "shrink the db by rewriting it",
+                        Action: downloader.HandleDBCompact,
+                    },
+                    {
+                        Name: "dump",
+                        Usage: "write the db as JSON to FILE or stdout",
+                        ArgsUsage: "[FILE]",
+                        Action: downloader.HandleDBDump,
+                    },
+                    {
+                        Name: "restore",
+                        Usage: "replace the db with a dump or backup, keeping the old one as .bak",
+                        ArgsUsage: "FILE",
+                        Action: downloader.HandleDBRestore,
+                    },
+                },
+            },
         },
         Action: func(c *cli.Context) error {
-            if blogURL != "" {
-                // check if it's a tumblr link
-                if strings.Contains(blogURL, ".tumblr.com") {
-                    downloader.HandleLink(c, blogURL)
-                } else if strings.ContainsRune(blogURL, '.') && !strings.Contains(blogURL, ".tumblr.com") {
-                    // probably a custom domain
-                    downloader.HandleLink(c, blogURL)
-                } else {
-                    downloader.HandleLink(c, blogURL + ".tumblr.com")
-                }
+            if blogURL == "" {
+                cli.ShowAppHelp(c)
+                return errors.New("missing --download")
+            }
+
+            id, err := blogid.Parse(blogURL)
+            if err != nil {
+                return err
             }
 
-            return nil
+            return downloader.HandleLink(c, id)
         },
     }
 
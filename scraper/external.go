@@ -0,0 +1,149 @@
+package scraper
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// a video or link that isn't hosted by tumblr, written down so other tools can get at it
+type externalEmbed struct {
+	PostID    int64  `json:"post_id"`
+	Timestamp int64  `json:"timestamp"`
+	Type      string `json:"type"`
+	Provider  string `json:"provider,omitempty"`
+	URL       string `json:"url"`
+	EmbedHTML string `json:"embed_html,omitempty"`
+	Poster    string `json:"poster,omitempty"`
+
+	// links only
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	SiteName    string `json:"site_name,omitempty"`
+}
+
+// posts get scraped more than once, by resumed and reprocessed runs and the post command, but land in external.jsonl once
+func (e *externalEmbed) key() string {
+	target := e.URL
+	if len(target) == 0 {
+		target = e.EmbedHTML
+	}
+	return strconv.FormatInt(e.PostID, 10) + " " + target
+}
+
+// adds an external video or link to the post's metadata and meta/<blog>/external.jsonl
+func (sc *scrapeContext) recordExternal(post *post, c *content) {
+	e := &externalEmbed{
+		PostID:      post.id,
+		Timestamp:   post.Timestamp,
+		Type:        c.Type,
+		Provider:    c.Provider,
+		URL:         c.URL,
+		EmbedHTML:   c.EmbedHTML,
+		Poster:      posterURL(c),
+		Title:       c.Title,
+		Description: c.Description,
+		SiteName:    c.SiteName,
+	}
+
+	// there's nothing to point other tools at
+	if len(e.URL) == 0 && len(e.EmbedHTML) == 0 {
+		return
+	}
+
+	post.metaLock.Lock()
+	post.external = append(post.external, e)
+	post.metaLock.Unlock()
+
+	// dry runs don't write anything
+	if sc.plan != nil {
+		return
+	}
+
+	err := sc.appendExternal(e)
+	if err != nil {
+		log.Printf("%s: failed to record %s: %v", sc.link, e.URL, err)
+	}
+}
+
+func (sc *scrapeContext) appendExternal(e *externalEmbed) error {
+	// embed html stays readable
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+
+	err := enc.Encode(e)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(sc.config.Save, "meta", sc.blog)
+	path := filepath.Join(dir, "external.jsonl")
+
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	sc.externalLock.Lock()
+	defer sc.externalLock.Unlock()
+
+	if sc.externalSeen == nil {
+		sc.externalSeen, err = loadExternalKeys(path)
+		if err != nil {
+			return err
+		}
+	}
+
+	key := e.key()
+	if _, ok := sc.externalSeen[key]; ok {
+		return nil
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(buf.Bytes())
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		sc.externalSeen[key] = struct{}{}
+	}
+
+	return err
+}
+
+// the keys of what earlier runs wrote to external.jsonl
+func loadExternalKeys(path string) (map[string]struct{}, error) {
+	seen := make(map[string]struct{})
+
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return seen, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	// embed html can make for long lines
+	s.Buffer(nil, 16<<20)
+	for s.Scan() {
+		var e externalEmbed
+		// a line cut short by a crash gets written again
+		if json.Unmarshal(s.Bytes(), &e) != nil {
+			continue
+		}
+		seen[e.key()] = struct{}{}
+	}
+
+	return seen, s.Err()
+}
@@ -0,0 +1,46 @@
+package scraper
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/soeux/tumtum/config"
+)
+
+func TestAppendExternalOnce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tumtum-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	embeds := []*externalEmbed{
+		{PostID: 1, Type: "video", URL: "https://www.youtube.com/watch?v=1"},
+		{PostID: 1, Type: "link", URL: "https://example.com"},
+		{PostID: 2, Type: "video", EmbedHTML: "<iframe></iframe>"},
+	}
+
+	// every run starts with nothing loaded, like a resumed or reprocessed scrape would
+	for run := 0; run < 3; run++ {
+		sc := &scrapeContext{config: &config.Config{Save: dir}, blog: testBlog}
+		for _, e := range embeds {
+			for i := 0; i < 2; i++ {
+				err := sc.appendExternal(e)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "meta", testBlog, "external.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(data, []byte("\n")); n != len(embeds) {
+		t.Errorf("external.jsonl has %d lines, want %d:\n%s", n, len(embeds), data)
+	}
+}
@@ -0,0 +1,120 @@
+package scraper
+
+import (
+	"mime"
+	"path"
+	"strings"
+
+	"github.com/soeux/tumtum/config"
+)
+
+// checks the posts setting to see if a post should be scraped at all
+func (sc *scrapeContext) wantPost(p *post) bool {
+	reblog := p.isReblog()
+
+	switch sc.config.Posts {
+	case config.PostsOriginal:
+		if reblog {
+			return false
+		}
+	case config.PostsReblogs:
+		if !reblog {
+			return false
+		}
+	}
+
+	// original posts weren't reblogged from anyone, so they never match root_blogs
+	if len(sc.config.RootBlogs) != 0 {
+		return reblog && sc.isWantedRootBlog(p.rootBlogName())
+	}
+
+	return true
+}
+
+// the post's own content is whatever the blog added on top of the trail
+func (sc *scrapeContext) wantOwnContent(p *post) bool {
+	// with root_blogs set we only care about the reblogged media
+	return len(sc.config.RootBlogs) == 0
+}
+
+func (sc *scrapeContext) wantTrailEntry(t *trailEntry) bool {
+	if len(sc.config.RootBlogs) == 0 {
+		return true
+	}
+
+	return sc.isWantedRootBlog(t.blogName())
+}
+
+func (sc *scrapeContext) isWantedRootBlog(name string) bool {
+	for _, b := range sc.config.RootBlogs {
+		if strings.EqualFold(blogName(b), blogName(name)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// media_kinds empty means everything is wanted
+func (sc *scrapeContext) wantMediaKind(kind string) bool {
+	if len(sc.config.MediaKinds) == 0 {
+		return true
+	}
+
+	for _, k := range sc.config.MediaKinds {
+		if k == kind {
+			return true
+		}
+	}
+
+	return false
+}
+
+// unknown dimensions are let through
+func (sc *scrapeContext) wantImageSize(width, height int) bool {
+	if width > 0 && width < sc.config.MinWidth {
+		return false
+	}
+	if height > 0 && height < sc.config.MinHeight {
+		return false
+	}
+	return true
+}
+
+// the deny list wins over the allow list
+func (sc *scrapeContext) wantMIMEType(contentType string) bool {
+	typ, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		// no or broken Content-Type, we'll let the extension sort it out
+		return len(sc.config.MIMEAllow) == 0
+	}
+
+	if matchMIMEType(sc.config.MIMEDeny, typ) {
+		return false
+	}
+
+	return len(sc.config.MIMEAllow) == 0 || matchMIMEType(sc.config.MIMEAllow, typ)
+}
+
+// patterns are either full types or wildcards like image/*
+func matchMIMEType(patterns []string, typ string) bool {
+	for _, p := range patterns {
+		p = strings.ToLower(p)
+		if p == typ || p == "*/*" {
+			return true
+		}
+		if strings.HasSuffix(p, "/*") && strings.HasPrefix(typ, strings.TrimSuffix(p, "*")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// NPF marks gifs as images, so tell them apart by type or extension
+func imageKind(rawurl, typ string) string {
+	if typ == "image/gif" || strings.EqualFold(path.Ext(rawurl), ".gif") {
+		return config.MediaGIF
+	}
+	return config.MediaImage
+}
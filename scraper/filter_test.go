@@ -0,0 +1,55 @@
+package scraper
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestSkippedFilesArentRecorded(t *testing.T) {
+	tests := []struct {
+		name  string
+		apply func(ts *testScraper)
+	}{
+		{"mime_deny", func(ts *testScraper) { ts.cfg.MIMEDeny = []string{"image/*"} }},
+		{"mime_allow", func(ts *testScraper) { ts.cfg.MIMEAllow = []string{"video/*"} }},
+		{"max_file_size", func(ts *testScraper) { ts.cfg.MaxFileSize = 2 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			posts := postsFrom(1, 1500000000, 1)
+			posts[0].Image = "a.jpg"
+
+			ts := newTestScraper(t, &fakeAPI{posts: posts})
+			defer ts.close()
+			tt.apply(ts)
+
+			ts.scrape(t, nil)
+
+			st := ts.Stats()
+			if st.FilesSkipped != 1 || st.FilesWritten != 0 {
+				t.Errorf("%d files skipped and %d written, want 1 and 0", st.FilesSkipped, st.FilesWritten)
+			}
+
+			data, err := ioutil.ReadFile(filepath.Join(ts.cfg.Save, "meta", testBlog, "1.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var meta postMeta
+			err = json.Unmarshal(data, &meta)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(meta.Files) != 0 {
+				t.Errorf("skipped files are in the metadata: %+v", meta.Files)
+			}
+
+			if !ts.scraped(t, posts)[1] {
+				t.Error("a post whose files were all skipped wasn't recorded")
+			}
+		})
+	}
+}
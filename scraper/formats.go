@@ -0,0 +1,65 @@
+package scraper
+
+import (
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+const (
+	// anything but WebP, which tumblr's CDN sends in place of GIFs, PNGs and JPEGs to whoever accepts it
+	acceptOriginal = "image/gif,image/png,image/jpeg,video/*,audio/*,*/*;q=0.8"
+	// what a browser sends
+	acceptWebP = "image/webp,image/*,video/*,audio/*,*/*;q=0.8"
+	// the last resort for GIFs that came back as something else
+	acceptGIF = "image/gif"
+)
+
+// headers for requests of media, as opposed to the api
+func (sc *scrapeContext) mediaHeader(accept string) http.Header {
+	if len(accept) == 0 {
+		accept = acceptOriginal
+		if sc.config.AllowWebP {
+			accept = acceptWebP
+		}
+	}
+
+	return http.Header{"Accept": {accept}}
+}
+
+// if a GIF came back as WebP or a still image, asks again for just the GIF
+// returns nil if that didn't get us anything better, otherwise the response to use instead of res
+func (sc *scrapeContext) retryGIF(u *url.URL, res *http.Response) *http.Response {
+	if !isGIFURL(u) || res.StatusCode != http.StatusOK {
+		return nil
+	}
+
+	got, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if got == "image/gif" {
+		return nil
+	}
+
+	retry, err := sc.doGetRequest(u, sc.mediaHeader(acceptGIF))
+	if err != nil {
+		log.Printf("%s: %s was served as %s, asking for the GIF failed: %v", sc.link, u, got, err)
+		return nil
+	}
+
+	typ, _, _ := mime.ParseMediaType(retry.Header.Get("Content-Type"))
+	if retry.StatusCode != http.StatusOK || typ != "image/gif" {
+		retry.Body.Close()
+		log.Printf("%s: %s was served as %s and there's no GIF of it, keeping that", sc.link, u, got)
+		return nil
+	}
+
+	log.Printf("%s: %s was served as %s, got the GIF instead", sc.link, u, got)
+	return retry
+}
+
+func isGIFURL(u *url.URL) bool {
+	ext := strings.ToLower(path.Ext(u.Path))
+	return ext == ".gif" || ext == ".gifv"
+}
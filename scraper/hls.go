@@ -0,0 +1,496 @@
+package scraper
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// segments of a video downloaded at once, on top of the download holding the semaphore
+const hlsConcurrency = 4
+
+var (
+	errHLSEncrypted = errors.New("encrypted HLS isn't supported")
+	// the segments add up to more than max_file_size
+	errHLSTooLarge = errors.New("over the size limit")
+)
+
+// playlist names that say nothing about the video they're for
+var genericPlaylistNames = map[string]bool{
+	"index":    true,
+	"master":   true,
+	"playlist": true,
+	"stream":   true,
+}
+
+func isHLSURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && strings.HasSuffix(strings.ToLower(u.Path), ".m3u8")
+}
+
+// a parsed .m3u8, either a master playlist of variants or a media playlist of segments
+type hlsPlaylist struct {
+	variants []hlsVariant
+	// EXT-X-MEDIA audio renditions by GROUP-ID, for variants whose audio isn't in their segments
+	audio map[string][]hlsRendition
+	// MPEG-TS, or fragmented MP4 with init holding the EXT-X-MAP
+	segments []*url.URL
+	init     *url.URL
+}
+
+type hlsVariant struct {
+	url       *url.URL
+	bandwidth int64
+	pixels    int
+	// the GROUP-ID of its audio renditions, if it has any
+	audio string
+}
+
+type hlsRendition struct {
+	// nil if the audio is in the variant's segments after all
+	url       *url.URL
+	isDefault bool
+}
+
+// the playlist of the audio that goes with v, the default rendition if there is one, or nil
+func (pl *hlsPlaylist) audioFor(v hlsVariant) *url.URL {
+	var first *url.URL
+	for _, r := range pl.audio[v.audio] {
+		if r.url == nil {
+			continue
+		}
+		if r.isDefault {
+			return r.url
+		}
+		if first == nil {
+			first = r.url
+		}
+	}
+	return first
+}
+
+// downloads the best variant of an HLS video and stitches its segments into one file
+// audio that comes separately goes next to it as <name>.audio, since stitching the two together would take a muxer
+func (sc *scrapeContext) downloadHLS(post *post, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	pl, err := sc.fetchPlaylist(u)
+	if err != nil {
+		return err
+	}
+
+	// master playlists only point at the actual ones, best first after sorting
+	var audio *url.URL
+	if len(pl.variants) != 0 {
+		sort.Slice(pl.variants, func(i, j int) bool {
+			a, b := pl.variants[i], pl.variants[j]
+			if a.pixels != b.pixels {
+				return a.pixels > b.pixels
+			}
+			return a.bandwidth > b.bandwidth
+		})
+
+		audio = pl.audioFor(pl.variants[0])
+
+		pl, err = sc.fetchPlaylist(pl.variants[0].url)
+		if err != nil {
+			return err
+		}
+	}
+
+	name := hlsFileName(u, post)
+
+	err = sc.downloadHLSStream(post, rawURL, pl, name, false)
+	if err != nil || audio == nil {
+		return err
+	}
+
+	pl, err = sc.fetchPlaylist(audio)
+	if err != nil {
+		return err
+	}
+
+	err = sc.downloadHLSStream(post, audio.String(), pl, name+".audio", true)
+	if err == nil {
+		post.addFile(audio.String(), resolution{URL: audio.String()})
+	}
+
+	return err
+}
+
+// downloads the segments of a media playlist into name plus the extension that fits them
+func (sc *scrapeContext) downloadHLSStream(post *post, rawURL string, pl *hlsPlaylist, name string, audio bool) error {
+	if len(pl.segments) == 0 {
+		return fmt.Errorf("%s has no segments", rawURL)
+	}
+
+	ext, typ := ".ts", "video/mp2t"
+	switch {
+	case pl.init != nil && audio:
+		ext, typ = ".m4a", "audio/mp4"
+	case pl.init != nil:
+		ext, typ = ".mp4", "video/mp4"
+	case audio && strings.EqualFold(path.Ext(pl.segments[0].Path), ".aac"):
+		// packed audio, which is just ADTS frames back to back
+		ext, typ = ".aac", "audio/aac"
+	}
+
+	if !sc.wantMIMEType(typ) {
+		log.Printf("%s: skipping %s: unwanted type %s", sc.link, rawURL, typ)
+		atomic.AddInt64(&sc.scraper.stats.FilesSkipped, 1)
+		return errSkipped
+	}
+
+	dst := filepath.Join(sc.config.Save, name+ext)
+
+	// file already exists -> skip
+	if _, err := os.Lstat(dst); err == nil {
+		log.Printf("%s: skipping %s", sc.link, dst)
+		atomic.AddInt64(&sc.scraper.stats.FilesSkipped, 1)
+		return nil
+	}
+
+	if !acquireFile(dst) {
+		return nil
+	}
+	defer releaseFile(dst)
+
+	parts := pl.segments
+	if pl.init != nil {
+		parts = append([]*url.URL{pl.init}, parts...)
+	}
+
+	tmp, err := ioutil.TempDir(sc.config.Save, ".hls-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	// streams can go on for a long time, so the limit is checked as the segments come in
+	err = sc.downloadSegments(parts, tmp)
+	if err == errHLSTooLarge {
+		log.Printf("%s: skipping %s: over the size limit", sc.link, rawURL)
+		atomic.AddInt64(&sc.scraper.stats.FilesSkipped, 1)
+		return errSkipped
+	}
+	if err != nil {
+		return err
+	}
+
+	n, err := concatSegments(tmp, len(parts), dst)
+	if err != nil {
+		return err
+	}
+
+	fileTime := post.timestamp()
+	err = os.Chtimes(dst, fileTime, fileTime)
+	if err != nil {
+		return err
+	}
+
+	atomic.AddInt64(&sc.scraper.stats.FilesWritten, 1)
+	atomic.AddInt64(&sc.scraper.stats.BytesWritten, n)
+	log.Printf("%s: wrote %s (%d segments)", sc.link, dst, len(pl.segments))
+
+	sc.fireFileWritten(post, dst, rawURL, typ, n)
+	return nil
+}
+
+// named after the playlist, or the directory it's in if it's just called master.m3u8 or the like
+func hlsFileName(u *url.URL, post *post) string {
+	p := strings.TrimSuffix(u.Path, "/")
+	for p != "/" && p != "." && len(p) != 0 {
+		name := strings.TrimSuffix(path.Base(p), path.Ext(p))
+		if len(name) != 0 && !genericPlaylistNames[strings.ToLower(name)] {
+			return name
+		}
+		p = path.Dir(p)
+	}
+
+	return fmt.Sprintf("tumblr_%d_hls", post.id)
+}
+
+func (sc *scrapeContext) fetchPlaylist(u *url.URL) (*hlsPlaylist, error) {
+	res, err := sc.doGetRequest(u, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		// continue
+	case http.StatusNotFound:
+		return nil, errFileNotFound
+	default:
+		return nil, fmt.Errorf("GET %s failed with: %d %s", u, res.StatusCode, res.Status)
+	}
+
+	// relative URIs are relative to wherever we ended up after redirects
+	return parsePlaylist(res.Request.URL, res.Body)
+}
+
+func parsePlaylist(base *url.URL, r io.Reader) (*hlsPlaylist, error) {
+	pl := &hlsPlaylist{}
+
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, 1024*1024)
+
+	first := true
+	var pending *hlsVariant
+
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		if len(line) == 0 {
+			continue
+		}
+
+		if first {
+			if line != "#EXTM3U" {
+				return nil, fmt.Errorf("%s is not an HLS playlist", base)
+			}
+			first = false
+			continue
+		}
+
+		if !strings.HasPrefix(line, "#") {
+			u, err := base.Parse(line)
+			if err != nil {
+				return nil, err
+			}
+
+			if pending != nil {
+				pending.url = u
+				pl.variants = append(pl.variants, *pending)
+				pending = nil
+			} else {
+				pl.segments = append(pl.segments, u)
+			}
+			continue
+		}
+
+		tag, attrs := splitTag(line)
+
+		switch tag {
+		case "#EXT-X-STREAM-INF":
+			v := &hlsVariant{audio: attrs["AUDIO"]}
+			v.bandwidth, _ = strconv.ParseInt(attrs["BANDWIDTH"], 10, 64)
+			if res := strings.SplitN(attrs["RESOLUTION"], "x", 2); len(res) == 2 {
+				w, _ := strconv.Atoi(res[0])
+				h, _ := strconv.Atoi(res[1])
+				v.pixels = w * h
+			}
+			pending = v
+		case "#EXT-X-MEDIA":
+			if attrs["TYPE"] != "AUDIO" {
+				continue
+			}
+
+			r := hlsRendition{isDefault: attrs["DEFAULT"] == "YES"}
+			if uri := attrs["URI"]; len(uri) != 0 {
+				u, err := base.Parse(uri)
+				if err != nil {
+					return nil, err
+				}
+				r.url = u
+			}
+
+			if pl.audio == nil {
+				pl.audio = make(map[string][]hlsRendition)
+			}
+			pl.audio[attrs["GROUP-ID"]] = append(pl.audio[attrs["GROUP-ID"]], r)
+		case "#EXT-X-KEY":
+			if m := attrs["METHOD"]; len(m) != 0 && m != "NONE" {
+				return nil, errHLSEncrypted
+			}
+		case "#EXT-X-MAP":
+			u, err := base.Parse(attrs["URI"])
+			if err != nil {
+				return nil, err
+			}
+			pl.init = u
+		}
+	}
+
+	if first {
+		return nil, fmt.Errorf("%s is empty", base)
+	}
+
+	return pl, s.Err()
+}
+
+// splits `#TAG:A=1,B="x,y"` into the tag and its attributes
+func splitTag(line string) (string, map[string]string) {
+	i := strings.IndexByte(line, ':')
+	if i < 0 {
+		return line, nil
+	}
+
+	tag, rest := line[:i], line[i+1:]
+	attrs := make(map[string]string)
+
+	for len(rest) != 0 {
+		eq := strings.IndexByte(rest, '=')
+		if eq < 0 {
+			break
+		}
+		key := strings.TrimSpace(rest[:eq])
+		rest = rest[eq+1:]
+
+		var val string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				val, rest = rest[1:], ""
+			} else {
+				val, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			end := strings.IndexByte(rest, ',')
+			if end < 0 {
+				val, rest = rest, ""
+			} else {
+				val, rest = rest[:end], rest[end:]
+			}
+		}
+		attrs[key] = val
+
+		rest = strings.TrimPrefix(rest, ",")
+	}
+
+	return tag, attrs
+}
+
+// downloads every segment into dir, named after its index
+// fails with errHLSTooLarge as soon as they add up to more than max_file_size
+func (sc *scrapeContext) downloadSegments(parts []*url.URL, dir string) error {
+	eg, ctx := errgroup.WithContext(sc.ctx)
+	sema := make(chan struct{}, hlsConcurrency)
+	size := &sizeLimit{max: sc.config.MaxFileSize}
+
+	for i, u := range parts {
+		i, u := i, u
+
+		select {
+		case sema <- struct{}{}:
+		case <-ctx.Done():
+			if err := eg.Wait(); err != nil {
+				return err
+			}
+			return ctx.Err()
+		}
+
+		eg.Go(func() error {
+			defer func() { <-sema }()
+			return sc.downloadSegment(u, filepath.Join(dir, strconv.Itoa(i)), size)
+		})
+	}
+
+	return eg.Wait()
+}
+
+// counts the bytes of all segments of a stream, which are downloaded at the same time
+type sizeLimit struct {
+	// accessed atomically
+	total int64
+	// 0 means no limit
+	max int64
+}
+
+func (l *sizeLimit) reader(r io.Reader) io.Reader {
+	return &sizeLimitReader{r: r, limit: l}
+}
+
+type sizeLimitReader struct {
+	r     io.Reader
+	limit *sizeLimit
+}
+
+func (r *sizeLimitReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	if atomic.AddInt64(&r.limit.total, int64(n)) > r.limit.max && r.limit.max > 0 {
+		return n, errHLSTooLarge
+	}
+	return n, err
+}
+
+func (sc *scrapeContext) downloadSegment(u *url.URL, path string, size *sizeLimit) error {
+	res, err := sc.doGetRequest(u, nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s failed with: %d %s", u, res.StatusCode, res.Status)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(file, size.reader(res.Body))
+	if e := file.Close(); err == nil {
+		err = e
+	}
+
+	return err
+}
+
+// MPEG-TS segments, and the fragments of fragmented MP4 after its init segment, play fine back to back
+// so stitching them together is just concatenation
+func concatSegments(dir string, n int, dst string) (int64, error) {
+	out, err := ioutil.TempFile(filepath.Dir(dst), filepath.Base(dst)+".tmp")
+	if err != nil {
+		return 0, err
+	}
+	tmp := out.Name()
+
+	var total int64
+	for i := 0; i < n && err == nil; i++ {
+		var in *os.File
+		in, err = os.Open(filepath.Join(dir, strconv.Itoa(i)))
+		if err != nil {
+			break
+		}
+
+		var written int64
+		written, err = io.Copy(out, in)
+		total += written
+		_ = in.Close()
+	}
+
+	if e := out.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Chmod(tmp, 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp, dst)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return 0, err
+	}
+
+	return total, nil
+}
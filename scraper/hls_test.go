@@ -0,0 +1,123 @@
+package scraper
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"golang.org/x/sync/errgroup"
+)
+
+const hlsMaster = `#EXTM3U
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aud",NAME="commentary",DEFAULT=NO,URI="alt/audio.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aud",NAME="main",DEFAULT=YES,URI="main/audio.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=1000,RESOLUTION=640x360,AUDIO="aud"
+low.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=3000,RESOLUTION=1280x720,AUDIO="aud"
+high.m3u8
+`
+
+// serves files, and counts the requests for segments
+type fakeHLS struct {
+	files    map[string]string
+	segments int64
+}
+
+func (f *fakeHLS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, ok := f.files[r.URL.Path]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if !strings.HasSuffix(r.URL.Path, ".m3u8") {
+		atomic.AddInt64(&f.segments, 1)
+	}
+	_, _ = w.Write([]byte(body))
+}
+
+// a media playlist of n segments named prefix0.ext, prefix1.ext...
+func mediaPlaylist(hls *fakeHLS, dir, prefix, ext string, n int, body string) string {
+	pl := "#EXTM3U\n"
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("%s%d%s", prefix, i, ext)
+		pl += "#EXTINF:1,\n" + name + "\n"
+		hls.files[dir+name] = body
+	}
+	return pl
+}
+
+func newHLSTest(t *testing.T, hls *fakeHLS) (*testScraper, *scrapeContext, *httptest.Server) {
+	ts := newTestScraper(t, &fakeAPI{})
+	if err := os.MkdirAll(ts.cfg.Save, 0755); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(hls)
+
+	sc := newScrapeContext(ts.Scraper, ts.cfg, &Options{}, testBlog, &errgroup.Group{}, context.Background())
+	return ts, sc, srv
+}
+
+func TestHLSSeparateAudio(t *testing.T) {
+	hls := &fakeHLS{files: map[string]string{"/clip/master.m3u8": hlsMaster}}
+	hls.files["/clip/high.m3u8"] = mediaPlaylist(hls, "/clip/", "v", ".ts", 2, "video")
+	hls.files["/clip/low.m3u8"] = mediaPlaylist(hls, "/clip/", "low", ".ts", 2, "low")
+	hls.files["/clip/main/audio.m3u8"] = mediaPlaylist(hls, "/clip/main/", "a", ".aac", 2, "audio")
+	hls.files["/clip/alt/audio.m3u8"] = mediaPlaylist(hls, "/clip/alt/", "a", ".aac", 2, "commentary")
+
+	ts, sc, srv := newHLSTest(t, hls)
+	defer ts.close()
+	defer srv.Close()
+
+	p := &post{id: 1, Timestamp: 1500000000}
+	err := sc.downloadHLS(p, srv.URL+"/clip/master.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{"clip.ts": "videovideo", "clip.audio.aac": "audioaudio"} {
+		data, err := ioutil.ReadFile(filepath.Join(ts.cfg.Save, name))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if string(data) != want {
+			t.Errorf("%s is %q, want %q", name, data, want)
+		}
+	}
+
+	if len(p.files) != 1 || p.files[0].URL != srv.URL+"/clip/main/audio.m3u8" {
+		t.Errorf("the post's files are %+v, want the default audio rendition", p.files)
+	}
+}
+
+func TestHLSSizeLimit(t *testing.T) {
+	const segments = 40
+
+	hls := &fakeHLS{files: map[string]string{}}
+	hls.files["/clip/index.m3u8"] = mediaPlaylist(hls, "/clip/", "v", ".ts", segments, strings.Repeat("x", 1024))
+
+	ts, sc, srv := newHLSTest(t, hls)
+	defer ts.close()
+	defer srv.Close()
+	ts.cfg.MaxFileSize = 4 * 1024
+
+	err := sc.downloadHLS(&post{id: 1, Timestamp: 1500000000}, srv.URL+"/clip/index.m3u8")
+	if err != errSkipped {
+		t.Fatalf("got %v for a stream over max_file_size, want errSkipped", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(ts.cfg.Save, "clip.ts")); !os.IsNotExist(err) {
+		t.Errorf("the stream was written anyway: %v", err)
+	}
+	if n := atomic.LoadInt64(&hls.segments); n >= segments {
+		t.Errorf("all %d segments were downloaded, it should've stopped at the limit", n)
+	}
+}
@@ -0,0 +1,132 @@
+package scraper
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/soeux/tumtum/config"
+	"github.com/soeux/tumtum/hooks"
+	"github.com/soeux/tumtum/webhook"
+)
+
+// nothing is written during dry runs, so no hooks run either
+
+func (sc *scrapeContext) fireFileWritten(post *post, path, rawURL, mediaType string, size int64) {
+	if sc.plan != nil || !sc.scraper.hooks.Has(config.HookFileWritten) {
+		return
+	}
+
+	sc.scraper.hooks.Fire(sc.runCtx, config.HookFileWritten, hooks.Env{
+		"PATH":       path,
+		"URL":        rawURL,
+		"BLOG":       sc.blog,
+		"POST_ID":    strconv.FormatInt(post.id, 10),
+		"TIMESTAMP":  strconv.FormatInt(post.timestamp().Unix(), 10),
+		"MEDIA_TYPE": mediaType,
+		"SIZE":       strconv.FormatInt(size, 10),
+	})
+}
+
+func (sc *scrapeContext) firePostDone(post *post) {
+	if sc.plan != nil || !sc.scraper.hooks.Has(config.HookPostDone) {
+		return
+	}
+
+	post.metaLock.Lock()
+	files := len(post.files)
+	post.metaLock.Unlock()
+
+	sc.scraper.hooks.Fire(sc.runCtx, config.HookPostDone, hooks.Env{
+		"BLOG":      sc.blog,
+		"POST_ID":   strconv.FormatInt(post.id, 10),
+		"TIMESTAMP": strconv.FormatInt(post.timestamp().Unix(), 10),
+		"FILES":     strconv.Itoa(files),
+	})
+}
+
+// also sends the blog-finished webhook
+func (sc *scrapeContext) fireBlogDone(err error) {
+	sc.notifyBlogFinished(err)
+
+	if sc.plan != nil || !sc.scraper.hooks.Has(config.HookBlogDone) {
+		return
+	}
+
+	env := hooks.Env{
+		"BLOG":   sc.blog,
+		"STATUS": runStatus(err, sc.stopping()),
+	}
+	if err != nil {
+		env["ERROR"] = err.Error()
+	}
+
+	sc.scraper.hooks.Fire(sc.runCtx, config.HookBlogDone, env)
+}
+
+// runs the run-done hooks and sends the run-finished webhook with the Stats of the run,
+// then waits for all hooks to finish and all webhooks to be delivered
+// returns err, or the failure of a hook that aborted the run
+func (s *Scraper) Finish(ctx context.Context, opts *Options, err error) error {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	if err == nil {
+		err = s.hooks.Err()
+	}
+
+	st := s.Stats()
+
+	if !opts.dryRun() && s.hooks.Has(config.HookRunDone) {
+		env := hooks.Env{
+			"STATUS":        runStatus(err, opts.stopped()),
+			"PAGES":         strconv.FormatInt(st.Pages, 10),
+			"POSTS_SCRAPED": strconv.FormatInt(st.Posts, 10),
+			"POSTS_KNOWN":   strconv.FormatInt(st.PostsKnown, 10),
+			"FILES_WRITTEN": strconv.FormatInt(st.FilesWritten, 10),
+			"BYTES_WRITTEN": strconv.FormatInt(st.BytesWritten, 10),
+			"FILES_SKIPPED": strconv.FormatInt(st.FilesSkipped, 10),
+			"FILES_MISSING": strconv.FormatInt(st.FilesMissing, 10),
+			"FILES_FAILED":  strconv.FormatInt(st.FilesFailed, 10),
+		}
+		if err != nil {
+			env["ERROR"] = err.Error()
+		}
+
+		s.hooks.Fire(ctx, config.HookRunDone, env)
+	}
+
+	// a run-done hook that aborts can still fail the run
+	hookErr := s.hooks.Wait()
+	if err == nil {
+		err = hookErr
+	}
+
+	if !opts.dryRun() {
+		e := &webhook.Event{
+			Event:  config.WebhookRunFinished,
+			Status: runStatus(err, opts.stopped()),
+			Stats:  st,
+		}
+		if err != nil {
+			e.Error = s.scrub(err.Error())
+		}
+
+		s.webhooks.Send(e)
+	}
+	s.webhooks.Close()
+
+	return err
+}
+
+// "ok", "stopped" for ^C, or "error"
+func runStatus(err error, stopped bool) string {
+	switch {
+	case err != nil:
+		return "error"
+	case stopped:
+		return "stopped"
+	default:
+		return "ok"
+	}
+}
@@ -0,0 +1,118 @@
+package scraper
+
+import (
+	"log"
+	"strings"
+)
+
+// the same blog can be scraped as name.tumblr.com, as its custom domain or as its uuid, and blogs get renamed,
+// so every name it went by is an alias in the db for the one its posts were first kept under
+
+// points sc.blog at what sc.link is an alias for, if it's one
+func (sc *scrapeContext) resolveBlog() {
+	if blog, ok := sc.lookupAlias(sc.link); ok {
+		sc.blog = blog
+	}
+}
+
+// a blog we scraped before that 404s under its old name might've been renamed, in which case its uuid still works
+// returns notFound if that doesn't pan out
+func (sc *scrapeContext) findRenamedBlog(notFound error) (*blogInfo, error) {
+	saved, err := sc.scraper.db.BlogInfo(sc.blog)
+	if err != nil || saved == nil || len(saved.UUID) == 0 {
+		return nil, notFound
+	}
+
+	info, err := sc.fetchBlogInfo(saved.UUID)
+	if err != nil {
+		return nil, notFound
+	}
+
+	return info, nil
+}
+
+// settles on what the blog is kept under now that we know its uuid and current name, records its aliases,
+// and scrapes it under its current name from here on
+func (sc *scrapeContext) adoptBlog(info *blogInfo) {
+	current := info.Name + ".tumblr.com"
+
+	blog, ok := sc.lookupAlias(info.UUID)
+	if !ok {
+		blog, ok = sc.lookupAlias(sc.link)
+	}
+	if !ok {
+		blog, ok = sc.lookupAlias(current)
+	}
+	if !ok {
+		// blogs scraped before aliases were a thing are kept under whatever they were scraped as
+		blog = current
+		if n, err := sc.scraper.db.PostCount(sc.link); err == nil && n != 0 {
+			blog = sc.link
+		}
+	}
+
+	saved, err := sc.scraper.db.BlogInfo(blog)
+	if err != nil {
+		log.Printf("%s: failed to load blog info from db: %v", sc.link, err)
+	}
+
+	if saved != nil && len(saved.UUID) != 0 && len(info.UUID) != 0 && saved.UUID != info.UUID {
+		// somebody else took the name of a blog we're keeping, so this one goes by its uuid
+		log.Printf("%s: isn't the blog we scraped as %s before, keeping it under its uuid", sc.link, blog)
+		blog = info.UUID
+	} else if saved != nil && len(saved.Name) != 0 && saved.Name != info.Name {
+		log.Printf("%s: renamed from %s to %s, keeping it under %s", sc.link, saved.Name, info.Name, blog)
+	}
+
+	if current != sc.link {
+		log.Printf("%s: scraping as %s", sc.link, current)
+	}
+
+	// dry runs don't change the db
+	if sc.plan == nil {
+		for _, alias := range []string{sc.link, current, info.UUID} {
+			if len(alias) == 0 || alias == blog {
+				continue
+			}
+
+			err := sc.scraper.db.AddAlias(alias, blog)
+			if err != nil {
+				log.Printf("%s: failed to save alias %s: %v", sc.link, alias, err)
+			}
+		}
+	}
+
+	sc.blog = blog
+	sc.link = current
+}
+
+func (sc *scrapeContext) lookupAlias(alias string) (string, bool) {
+	if len(alias) == 0 {
+		return "", false
+	}
+
+	blog, ok, err := sc.scraper.db.ResolveAlias(alias)
+	if err != nil {
+		log.Printf("%s: failed to look up %s in db: %v", sc.link, alias, err)
+		return "", false
+	}
+
+	return blog, ok
+}
+
+// deactivated blogs keep their name with -deactivatedYYYYMMDD tacked on, which isn't who made the post
+func blogName(name string) string {
+	if deactivatedNameRegexp.MatchString(name) {
+		return name[:len(name)-deactivatedNameSuffixLength]
+	}
+	return name
+}
+
+// the name of the blog a trail entry came from, even if it was deleted since
+func (t *trailEntry) blogName() string {
+	name := t.Blog.Name
+	if len(name) == 0 {
+		name = t.BrokenBlogName
+	}
+	return blogName(strings.TrimSpace(name))
+}
@@ -0,0 +1,273 @@
+package scraper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/soeux/tumtum/database"
+)
+
+var (
+	errBlogNotFound = errors.New("blog not found")
+	// returned by loadBlogInfo when a sync has nothing to do
+	errUpToDate = errors.New("up to date")
+)
+
+type blogInfoResponse struct {
+	Response struct {
+		Blog blogInfo `json:"blog"`
+	} `json:"response"`
+}
+
+type blogInfo struct {
+	Name        string `json:"name"`
+	UUID        string `json:"uuid"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	URL         string `json:"url"`
+	Posts       int64  `json:"posts"`
+	Updated     int64  `json:"updated"`
+	Avatar      []struct {
+		URL    string `json:"url"`
+		Width  int    `json:"width"`
+		Height int    `json:"height"`
+	} `json:"avatar"`
+	Theme struct {
+		HeaderImage string `json:"header_image"`
+	} `json:"theme"`
+
+	// the blog as the api returned it
+	raw json.RawMessage
+}
+
+func (b *blogInfo) UnmarshalJSON(data []byte) error {
+	type plainBlogInfo blogInfo
+	err := json.Unmarshal(data, (*plainBlogInfo)(b))
+	if err != nil {
+		return err
+	}
+
+	b.raw = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+// fetches the blog's info before scraping, which also tells us if the blog exists at all
+func (sc *scrapeContext) loadBlogInfo() error {
+	sc.resolveBlog()
+
+	info, err := sc.fetchBlogInfo(sc.link)
+	if errors.Is(err, errBlogNotFound) {
+		info, err = sc.findRenamedBlog(err)
+	}
+	if err != nil {
+		return err
+	}
+
+	sc.adoptBlog(info)
+	sc.totalPosts = info.Posts
+
+	saved, err := sc.scraper.db.BlogInfo(sc.blog)
+	if err != nil {
+		log.Printf("%s: failed to load blog info from db: %v", sc.link, err)
+	}
+
+	log.Printf("%s: %q has %d posts, last updated %v", sc.link, info.Title, info.Posts, time.Unix(info.Updated, 0).Format("2Jan06 15:04:05"))
+
+	// dry runs don't change the db
+	if sc.plan == nil {
+		sc.saveBlogInfo(info, saved)
+	}
+
+	if sc.sync && saved != nil && saved.Synced != 0 && saved.Synced == info.Updated {
+		log.Printf("%s: nothing changed since the last sync", sc.link)
+		return errUpToDate
+	}
+
+	return nil
+}
+
+// saves the info to the db and meta/<blog>/, along with the avatar and header image
+func (sc *scrapeContext) saveBlogInfo(info *blogInfo, saved *database.BlogInfo) {
+	sc.info = &database.BlogInfo{
+		Name:        info.Name,
+		UUID:        info.UUID,
+		Title:       info.Title,
+		Description: info.Description,
+		URL:         info.URL,
+		Posts:       info.Posts,
+		Updated:     info.Updated,
+		Fetched:     time.Now(),
+	}
+	if saved != nil {
+		sc.info.Synced = saved.Synced
+	}
+
+	err := sc.scraper.db.SetBlogInfo(sc.blog, sc.info)
+	if err != nil {
+		log.Printf("%s: failed to save blog info: %v", sc.link, err)
+	}
+
+	err = sc.saveBlogMeta(info)
+	if err != nil {
+		log.Printf("%s: failed to write blog metadata: %v", sc.link, err)
+	}
+}
+
+// remembers that the blog was synced as of the info loaded before scraping
+func (sc *scrapeContext) markSynced() {
+	if sc.info == nil {
+		return
+	}
+
+	sc.info.Synced = sc.info.Updated
+
+	err := sc.scraper.db.SetBlogInfo(sc.blog, sc.info)
+	if err != nil {
+		log.Printf("%s: failed to save blog info: %v", sc.link, err)
+	}
+}
+
+// identifier is anything the api takes, e.g. a blog's name or its uuid
+func (sc *scrapeContext) fetchBlogInfo(identifier string) (*blogInfo, error) {
+	sc.sema.Acquire(0)
+	defer sc.sema.Release()
+
+	u, err := url.Parse(fmt.Sprintf("%s/blog/%s/info", sc.scraper.apiBase, identifier))
+	if err != nil {
+		panic(err)
+	}
+	u.RawQuery = url.Values{"api_key": {sc.config.APIKey}}.Encode()
+
+	res, err := sc.doGetRequest(u, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		// continue
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("%s: %w", identifier, errBlogNotFound)
+	default:
+		return nil, fmt.Errorf("GET %s failed with: %d %s", u, res.StatusCode, res.Status)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &blogInfoResponse{}
+	err = json.Unmarshal(body, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return &data.Response.Blog, nil
+}
+
+// writes meta/<blog>/info.json and downloads every avatar size and the header image next to it
+func (sc *scrapeContext) saveBlogMeta(info *blogInfo) error {
+	dir := filepath.Join(sc.config.Save, "meta", sc.blog)
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(filepath.Join(dir, "info.json"), info.raw, 0644)
+	if err != nil {
+		return err
+	}
+
+	var images []string
+	for _, a := range info.Avatar {
+		images = append(images, a.URL)
+	}
+	if len(info.Theme.HeaderImage) != 0 {
+		images = append(images, info.Theme.HeaderImage)
+	}
+
+	for _, rawURL := range images {
+		err = sc.saveBlogImage(dir, rawURL)
+		if err != nil && !isCanceled(sc.ctx, err) {
+			log.Printf("%s: failed to download %s: %v", sc.link, rawURL, err)
+		}
+	}
+
+	return nil
+}
+
+// images are named after their URL, so changed avatars are kept alongside the old ones
+func (sc *scrapeContext) saveBlogImage(dir, rawURL string) error {
+	path := filepath.Join(dir, filepath.Base(rawURL))
+
+	if _, err := os.Lstat(path); err == nil {
+		return nil
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	sc.sema.Acquire(0)
+	defer sc.sema.Release()
+
+	res, err := sc.doGetRequest(u, sc.mediaHeader(""))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s failed with: %d %s", rawURL, res.StatusCode, res.Status)
+	}
+
+	// avatars are .pnj and the like, which are png under a different name
+	if exts, _ := mime.ExtensionsByType(res.Header.Get("Content-Type")); len(exts) != 0 && !hasExt(path, exts) {
+		path = strings.TrimSuffix(path, filepath.Ext(path)) + exts[0]
+	}
+
+	if _, err := os.Lstat(path); err == nil {
+		return nil
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(file, res.Body)
+	if e := file.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		_ = os.Remove(path)
+		return err
+	}
+
+	log.Printf("%s: wrote %s", sc.link, path)
+	return nil
+}
+
+func hasExt(path string, exts []string) bool {
+	for _, ext := range exts {
+		if ext == filepath.Ext(path) {
+			return true
+		}
+	}
+	return false
+}
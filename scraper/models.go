@@ -1,7 +1,10 @@
 package scraper
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"sync"
 	"time"
 )
 
@@ -15,7 +18,22 @@ type post struct {
 	ID json.Number `json:"id"`
 	id int64
 
+	pending pendingState
+	// of the post's content and trail, to tell when it was edited
+	hash string
+	// already scraped with the same hash, so only the cursor needs it
+	known bool
+	// the post as the api returned it
+	raw json.RawMessage
+	// what was downloaded for the post and what couldn't be, for its metadata
+	metaLock sync.Mutex
+	files    []postFile
+	external []*externalEmbed
+	// some of its downloads failed, so it has to be scraped again
+	failed bool
+
 	Timestamp int64        `json:"timestamp"`
+	IsPinned  bool         `json:"is_pinned"`
 	Trail     []trailEntry `json:"trail"`
 
 	// NPF content
@@ -28,15 +46,69 @@ type post struct {
 	// Answer   string  `json:"answer"`
 
 	// reblogs
-	// RebloggedFromName string `json:"reblogged_from_name"`
-	// RebloggedRootName string `json:"reblogged_root_name"`
-	Reblog reblog `json:"reblog"`
+	RebloggedFromName string `json:"reblogged_from_name"`
+	RebloggedRootName string `json:"reblogged_root_name"`
+	ParentPostURL     string `json:"parent_post_url"`
+	Reblog            reblog `json:"reblog"`
+}
+
+func (s *post) UnmarshalJSON(data []byte) error {
+	type plainPost post
+	err := json.Unmarshal(data, (*plainPost)(s))
+	if err != nil {
+		return err
+	}
+
+	s.raw = append(json.RawMessage(nil), data...)
+
+	var raw struct {
+		Content json.RawMessage `json:"content"`
+	}
+	err = json.Unmarshal(data, &raw)
+	if err != nil {
+		return err
+	}
+
+	// only what the post and its trail say, note counts and the trail's blog details change without an edit
+	h := sha256.New()
+	h.Write(raw.Content)
+	for _, t := range s.Trail {
+		h.Write([]byte{0})
+		h.Write(t.Content)
+	}
+	s.hash = hex.EncodeToString(h.Sum(nil))
+
+	return nil
 }
 
 func (s *post) timestamp() time.Time {
 	return time.Unix(s.Timestamp, 0)
 }
 
+// original posts have neither a parent nor a trail
+func (s *post) isReblog() bool {
+	return len(s.RebloggedFromName) != 0 || len(s.ParentPostURL) != 0 || len(s.Trail) != 0
+}
+
+// name of the blog the post was originally made on
+func (s *post) rootBlogName() string {
+	if len(s.RebloggedRootName) != 0 {
+		return blogName(s.RebloggedRootName)
+	}
+
+	for i := range s.Trail {
+		if t := &s.Trail[i]; t.IsRootItem != nil && *t.IsRootItem {
+			return t.blogName()
+		}
+	}
+
+	if len(s.Trail) != 0 {
+		return s.Trail[0].blogName()
+	}
+
+	return ""
+}
+
 type photo struct {
 	OriginalSize photoVariant `json:"original_size"`
 }
@@ -63,15 +135,72 @@ type trailEntry struct {
 type content struct {
 	Type  string          `json:"type"`
 	Media json.RawMessage `json:"media"`
+
+	// video and link blocks
+	URL       string          `json:"url"`
+	Provider  string          `json:"provider"`
+	EmbedHTML string          `json:"embed_html"`
+	Poster    json.RawMessage `json:"poster"`
+	HLS       json.RawMessage `json:"hls"`
+
+	// link blocks
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	SiteName    string `json:"site_name"`
 }
 
-type imageMedia []struct {
+type imageMedia []imageVariant
+
+type imageVariant struct {
 	URL                   string `json:"url"`
+	Type                  string `json:"type"`
 	Width                 int    `json:"width"`
 	Height                int    `json:"height"`
 	HasOriginalDimensions bool   `json:"has_original_dimensions"`
 }
 
-type videoMedia struct {
-	URL string `json:"url"`
+// the original, or the largest variant there is, ms mustn't be empty
+func (ms imageMedia) best() imageVariant {
+	best := ms[0]
+
+	for _, m := range ms {
+		if m.HasOriginalDimensions {
+			return m
+		}
+		if m.Width*m.Height > best.Width*best.Height {
+			best = m
+		}
+	}
+
+	return best
+}
+
+type mediaObject struct {
+	URL    string `json:"url"`
+	Type   string `json:"type"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// the media of a video block, which is either one media object or a list of renditions
+type videoMedia []mediaObject
+
+func (v *videoMedia) UnmarshalJSON(data []byte) error {
+	if len(data) != 0 && data[0] == '[' {
+		return json.Unmarshal(data, (*[]mediaObject)(v))
+	}
+
+	var m mediaObject
+	err := json.Unmarshal(data, &m)
+	if err != nil {
+		return err
+	}
+
+	*v = videoMedia{m}
+	return nil
+}
+
+type audioMedia struct {
+	URL  string `json:"url"`
+	Type string `json:"type"`
 }
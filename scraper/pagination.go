@@ -0,0 +1,111 @@
+package scraper
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"sync/atomic"
+)
+
+// posts published in the same second share a timestamp and before= is exclusive,
+// so asking for posts before the last one we saw would skip any others from that second.
+// instead we ask for posts up to and including that second, and skip the ones we've seen already.
+// if a whole page is nothing but seen posts from that second, offset= gets us past them,
+// and if that doesn't work either we give up on the rest of that second rather than loop forever.
+type boundary struct {
+	// ids of the posts we've scraped from the cursor's second
+	seen map[int64]struct{}
+	// send offset=len(seen) along with before=
+	useOffset bool
+	// send before=cursor, i.e. skip the rest of the cursor's second
+	skipSecond bool
+}
+
+// the before= and offset= query values for the next page
+func (sc *scrapeContext) pageQuery() (before, offset string) {
+	if sc.boundary.skipSecond {
+		return strconv.FormatInt(sc.timeObj.Unix(), 10), ""
+	}
+
+	before = strconv.FormatInt(sc.timeObj.Unix()+1, 10)
+	if sc.boundary.useOffset {
+		offset = strconv.Itoa(len(sc.boundary.seen))
+	}
+
+	return
+}
+
+// moves the cursor to p, returns false if p was already scraped
+// p mustn't be newer than the cursor
+func (sc *scrapeContext) advanceCursor(p *post) bool {
+	if p.timestamp().Equal(sc.timeObj) {
+		if _, ok := sc.boundary.seen[p.id]; ok {
+			return false
+		}
+	} else {
+		sc.timeObj = p.timestamp()
+		atomic.StoreInt64(&sc.cursorUnix, sc.timeObj.Unix())
+		sc.boundary = boundary{}
+	}
+
+	if sc.boundary.seen == nil {
+		sc.boundary.seen = make(map[int64]struct{})
+	}
+	sc.boundary.seen[p.id] = struct{}{}
+
+	return true
+}
+
+// how many posts we ask for at once
+const pageLimit = 20
+
+// called after every page with its size and the number of posts we hadn't seen yet
+// returns false once there's nothing left to page through
+func (sc *scrapeContext) pageDone(size, fresh int) bool {
+	if fresh != 0 {
+		return true
+	}
+
+	// a short page of posts we've seen is just the end of the blog
+	if size < pageLimit {
+		return false
+	}
+
+	if !sc.boundary.useOffset {
+		sc.boundary.useOffset = true
+		return true
+	}
+
+	log.Printf("%s: more posts at %v than we can page through, skipping the rest of them", sc.link, sc.timeObj.Format("2Jan06 15:04:05"))
+	sc.boundary.skipSecond = true
+	return true
+}
+
+// how far through the blog we are, for the log
+// only full backfills and syncs count their posts from the top of the blog
+func (sc *scrapeContext) progress() string {
+	if sc.totalPosts <= 0 || (!sc.persist && !sc.sync) {
+		return ""
+	}
+
+	done := sc.offset
+	if done > sc.totalPosts {
+		done = sc.totalPosts
+	}
+
+	return fmt.Sprintf(" (%d of %d posts, %d%%)", done, sc.totalPosts, done*100/sc.totalPosts)
+}
+
+// remembers out of order posts so they're only scraped once per run, returns true if p was seen before
+func (sc *scrapeContext) seenOutOfOrder(p *post) bool {
+	if _, ok := sc.outOfOrder[p.id]; ok {
+		return true
+	}
+
+	if sc.outOfOrder == nil {
+		sc.outOfOrder = make(map[int64]struct{})
+	}
+	sc.outOfOrder[p.id] = struct{}{}
+
+	return false
+}
@@ -0,0 +1,426 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/soeux/tumtum/config"
+	"github.com/soeux/tumtum/database"
+)
+
+const (
+	testBlogName = "someblog"
+	// what the blog is scraped and kept under
+	testBlog = testBlogName + ".tumblr.com"
+)
+
+// see fakeAPI.media
+const dropConnection = -1
+
+type fakePost struct {
+	ID        int64 `json:"id"`
+	Timestamp int64 `json:"timestamp"`
+	IsPinned  bool  `json:"is_pinned"`
+	// the name of an image under /media/, if the post has one
+	Image string `json:"-"`
+	// a link block, if the post has one
+	Link string `json:"-"`
+
+	NoteCount int64       `json:"note_count"`
+	Trail     []fakeTrail `json:"trail,omitempty"`
+}
+
+type fakeTrail struct {
+	Blog struct {
+		Name  string `json:"name"`
+		Title string `json:"title"`
+	} `json:"blog"`
+	Content []fakeContent `json:"content"`
+}
+
+type fakeContent struct {
+	Type  string `json:"type"`
+	Media []struct {
+		URL string `json:"url"`
+	} `json:"media,omitempty"`
+	// link blocks
+	URL string `json:"url,omitempty"`
+}
+
+// just enough of /info and /posts to page through a blog
+type fakeAPI struct {
+	posts []fakePost
+	// like an api that doesn't do offset= together with before=
+	ignoreOffset bool
+	// status codes for /media/, 200 if missing, dropConnection to hang up instead
+	media map[string]int
+	// where the api is, for media URLs
+	base string
+	// when /info says the blog was last updated, if that's after its newest post
+	updated int64
+
+	lock    sync.Mutex
+	queries []string
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/info"):
+		updated := f.updated
+		for _, p := range f.posts {
+			if p.Timestamp > updated {
+				updated = p.Timestamp
+			}
+		}
+		writeResponse(w, map[string]interface{}{"blog": map[string]interface{}{
+			"name":    testBlogName,
+			"uuid":    "t:" + testBlogName,
+			"posts":   len(f.posts),
+			"updated": updated,
+		}})
+	case strings.HasSuffix(r.URL.Path, "/posts"):
+		f.lock.Lock()
+		f.queries = append(f.queries, r.URL.RawQuery)
+		f.lock.Unlock()
+
+		writeResponse(w, map[string]interface{}{"posts": f.render(f.page(r.URL.Query()))})
+	case strings.HasPrefix(r.URL.Path, "/media/"):
+		f.lock.Lock()
+		status, ok := f.media[strings.TrimPrefix(r.URL.Path, "/media/")]
+		f.lock.Unlock()
+
+		if ok && status == dropConnection {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				conn.Close()
+			}
+			return
+		}
+		if ok && status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "image/jpeg")
+		w.Header().Set("Content-Length", "4")
+		_, _ = w.Write([]byte("jpeg"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// newest first, pinned posts on top of the first page like tumblr does
+func (f *fakeAPI) page(q map[string][]string) []fakePost {
+	before, _ := strconv.ParseInt(first(q["before"]), 10, 64)
+	offset, _ := strconv.Atoi(first(q["offset"]))
+	limit, _ := strconv.Atoi(first(q["limit"]))
+	if f.ignoreOffset {
+		offset = 0
+	}
+
+	var page, rest []fakePost
+	for _, p := range f.posts {
+		if p.IsPinned {
+			if offset == 0 {
+				page = append(page, p)
+			}
+			continue
+		}
+		if before == 0 || p.Timestamp < before {
+			rest = append(rest, p)
+		}
+	}
+
+	sort.Slice(rest, func(i, j int) bool {
+		if rest[i].Timestamp != rest[j].Timestamp {
+			return rest[i].Timestamp > rest[j].Timestamp
+		}
+		return rest[i].ID > rest[j].ID
+	})
+
+	if offset > len(rest) {
+		offset = len(rest)
+	}
+	rest = rest[offset:]
+	if len(rest) > limit {
+		rest = rest[:limit]
+	}
+
+	return append(page, rest...)
+}
+
+// posts as the api has them, with their images and links as NPF content
+func (f *fakeAPI) render(posts []fakePost) []interface{} {
+	type renderedPost struct {
+		fakePost
+		Content []fakeContent `json:"content,omitempty"`
+	}
+
+	rendered := make([]interface{}, 0, len(posts))
+	for _, p := range posts {
+		r := renderedPost{fakePost: p}
+		if len(p.Image) != 0 {
+			c := fakeContent{Type: "image"}
+			c.Media = append(c.Media, struct {
+				URL string `json:"url"`
+			}{f.base + "/media/" + p.Image})
+			r.Content = append(r.Content, c)
+		}
+		if len(p.Link) != 0 {
+			r.Content = append(r.Content, fakeContent{Type: "link", URL: p.Link})
+		}
+		rendered = append(rendered, r)
+	}
+
+	return rendered
+}
+
+func (f *fakeAPI) setMedia(name string, status int) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.media == nil {
+		f.media = make(map[string]int)
+	}
+	f.media[name] = status
+}
+
+func (f *fakeAPI) usedOffset() bool {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for _, q := range f.queries {
+		if strings.Contains(q, "offset=") {
+			return true
+		}
+	}
+	return false
+}
+
+func first(vs []string) string {
+	if len(vs) == 0 {
+		return ""
+	}
+	return vs[0]
+}
+
+func writeResponse(w http.ResponseWriter, response interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{"response": response})
+}
+
+type testScraper struct {
+	*Scraper
+	cfg *config.Config
+	db  *database.Database
+
+	srv *httptest.Server
+	dir string
+}
+
+// a scraper pointed at api, with its own save location and db, close it when done
+func newTestScraper(t *testing.T, api *fakeAPI) *testScraper {
+	dir, err := ioutil.TempDir("", "tumtum-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{APIKey: "key", Concurrency: 2, Save: filepath.Join(dir, "save")}
+	err = cfg.Validate()
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	db, err := database.NewDB(filepath.Join(dir, "tumtum.db"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(api)
+	api.base = srv.URL
+
+	s := NewScraper(srv.Client(), cfg, db)
+	s.apiBase = srv.URL + "/v2"
+
+	return &testScraper{Scraper: s, cfg: cfg, db: db, srv: srv, dir: dir}
+}
+
+func (ts *testScraper) close() {
+	ts.srv.Close()
+	ts.db.Close()
+	os.RemoveAll(ts.dir)
+}
+
+func (ts *testScraper) scrape(t *testing.T, opts *Options) {
+	err := ts.Scrape(context.Background(), testBlog, ts.cfg, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// the ids of posts that made it into the db
+func (ts *testScraper) scraped(t *testing.T, posts []fakePost) map[int64]bool {
+	scraped := make(map[int64]bool)
+	for _, p := range posts {
+		_, found, err := ts.db.PostHash(testBlog, p.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found {
+			scraped[p.ID] = true
+		}
+	}
+	return scraped
+}
+
+// n posts one second apart, newest first, starting at ts
+func postsFrom(id, ts int64, n int) []fakePost {
+	posts := make([]fakePost, 0, n)
+	for i := 0; i < n; i++ {
+		posts = append(posts, fakePost{ID: id + int64(i), Timestamp: ts - int64(i)})
+	}
+	return posts
+}
+
+// n posts published in the same second
+func postsAt(id, ts int64, n int) []fakePost {
+	posts := make([]fakePost, 0, n)
+	for i := 0; i < n; i++ {
+		posts = append(posts, fakePost{ID: id + int64(i), Timestamp: ts})
+	}
+	return posts
+}
+
+func TestPaginationSharedSecond(t *testing.T) {
+	const second = 1500000000
+
+	var posts []fakePost
+	posts = append(posts, postsFrom(1, second+10, 10)...)
+	posts = append(posts, postsAt(100, second, 25)...)
+	posts = append(posts, postsFrom(200, second-1, 10)...)
+
+	api := &fakeAPI{posts: posts}
+	ts := newTestScraper(t, api)
+	defer ts.close()
+	ts.scrape(t, nil)
+
+	if scraped := ts.scraped(t, posts); len(scraped) != len(posts) {
+		t.Errorf("scraped %d of %d posts", len(scraped), len(posts))
+	}
+	if !api.usedOffset() {
+		t.Error("expected offset= to get past a full page of posts from the same second")
+	}
+	if n := ts.Stats().Posts; n != int64(len(posts)) {
+		t.Errorf("scraped %d posts, some of them more than once, want %d", n, len(posts))
+	}
+}
+
+func TestPaginationSkipSecond(t *testing.T) {
+	const second = 1500000000
+
+	shared := postsAt(100, second, 25)
+	older := postsFrom(200, second-1, 10)
+
+	var posts []fakePost
+	posts = append(posts, shared...)
+	posts = append(posts, older...)
+
+	// without offset= there's no way past the first 20 posts of that second
+	api := &fakeAPI{posts: posts, ignoreOffset: true}
+	ts := newTestScraper(t, api)
+	defer ts.close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ts.scrape(t, nil)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("paging through the same second never gave up")
+	}
+
+	scraped := ts.scraped(t, posts)
+	if n := len(ts.scraped(t, shared)); n != pageLimit {
+		t.Errorf("scraped %d posts from the shared second, want %d", n, pageLimit)
+	}
+	for _, p := range older {
+		if !scraped[p.ID] {
+			t.Errorf("post %d after the skipped second wasn't scraped", p.ID)
+		}
+	}
+}
+
+func TestPaginationResume(t *testing.T) {
+	const top = 1500000000
+
+	posts := postsFrom(1, top, 50)
+	// the cursor is inclusive, an interrupted run might not have finished the posts of its second
+	cursor := posts[30]
+
+	api := &fakeAPI{posts: posts}
+	ts := newTestScraper(t, api)
+	defer ts.close()
+
+	err := ts.db.SetTime(testBlog, time.Unix(cursor.Timestamp, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ts.scrape(t, nil)
+
+	scraped := ts.scraped(t, posts)
+	for _, p := range posts {
+		want := p.Timestamp <= cursor.Timestamp
+		if scraped[p.ID] != want {
+			t.Errorf("post %d at %d: scraped %v, want %v (cursor at %d)", p.ID, p.Timestamp, scraped[p.ID], want, cursor.Timestamp)
+		}
+	}
+
+	saved, err := ts.db.GetTime(testBlog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := posts[len(posts)-1].Timestamp; saved.Unix() != want {
+		t.Errorf("saved cursor %d, want the oldest post at %d", saved.Unix(), want)
+	}
+}
+
+func TestPaginationPinnedOutsideBounds(t *testing.T) {
+	const top = 1500000000
+
+	posts := postsFrom(1, top, 30)
+	pinned := fakePost{ID: 99, Timestamp: top + 1, IsPinned: true}
+	posts = append(posts, pinned)
+
+	api := &fakeAPI{posts: posts}
+	ts := newTestScraper(t, api)
+	defer ts.close()
+
+	until := time.Unix(top-10, 0)
+	ts.scrape(t, &Options{Until: until})
+
+	scraped := ts.scraped(t, posts)
+	if scraped[pinned.ID] {
+		t.Error("pinned post after --until was scraped")
+	}
+	for _, p := range posts[:30] {
+		if want := p.Timestamp < until.Unix(); scraped[p.ID] != want {
+			t.Errorf("post %d at %d: scraped %v, want %v", p.ID, p.Timestamp, scraped[p.ID], want)
+		}
+	}
+}
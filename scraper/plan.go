@@ -0,0 +1,276 @@
+package scraper
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	PlanTSV   = "tsv"
+	PlanJSON  = "json"
+	PlanJSONL = "jsonl"
+	PlanText  = "txt"
+	PlanAria2 = "aria2"
+)
+
+// a file that would be downloaded, used by dry runs
+type plannedFile struct {
+	PostID    int64     `json:"post_id"`
+	Timestamp time.Time `json:"timestamp"`
+	URL       string    `json:"url"`
+	Path      string    `json:"path"`
+	Size      int64     `json:"size,omitempty"` // only known with Options.Estimate
+}
+
+type planWriter interface {
+	write(f *plannedFile) error
+	close() error
+}
+
+func newPlanWriter(w io.Writer, format string) (planWriter, error) {
+	switch format {
+	case "", PlanTSV:
+		return &tsvPlanWriter{w: w}, nil
+	case PlanJSON:
+		return &jsonPlanWriter{w: w}, nil
+	case PlanJSONL:
+		return &jsonlPlanWriter{w: w}, nil
+	case PlanText:
+		return &textPlanWriter{w: w}, nil
+	case PlanAria2:
+		return &aria2PlanWriter{w: w}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+type tsvPlanWriter struct {
+	w           io.Writer
+	wroteHeader bool
+}
+
+func (p *tsvPlanWriter) write(f *plannedFile) error {
+	if !p.wroteHeader {
+		p.wroteHeader = true
+		_, err := io.WriteString(p.w, "post_id\ttimestamp\turl\tpath\tsize\n")
+		if err != nil {
+			return err
+		}
+	}
+
+	size := ""
+	if f.Size > 0 {
+		size = strconv.FormatInt(f.Size, 10)
+	}
+
+	_, err := fmt.Fprintf(p.w, "%d\t%s\t%s\t%s\t%s\n", f.PostID, f.Timestamp.Format(time.RFC3339), f.URL, f.Path, size)
+	return err
+}
+
+func (p *tsvPlanWriter) close() error {
+	return nil
+}
+
+// writes a single JSON array, one element per line
+type jsonPlanWriter struct {
+	w     io.Writer
+	count int
+}
+
+func (p *jsonPlanWriter) write(f *plannedFile) error {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	sep := ",\n"
+	if p.count == 0 {
+		sep = "[\n"
+	}
+	p.count++
+
+	_, err = fmt.Fprintf(p.w, "%s%s", sep, data)
+	return err
+}
+
+func (p *jsonPlanWriter) close() error {
+	end := "\n]\n"
+	if p.count == 0 {
+		end = "[]\n"
+	}
+
+	_, err := io.WriteString(p.w, end)
+	return err
+}
+
+// one JSON object per line
+type jsonlPlanWriter struct {
+	w io.Writer
+}
+
+func (p *jsonlPlanWriter) write(f *plannedFile) error {
+	data, err := json.Marshal(f)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(p.w, "%s\n", data)
+	return err
+}
+
+func (p *jsonlPlanWriter) close() error {
+	return nil
+}
+
+// just the URLs, for wget -i and friends
+type textPlanWriter struct {
+	w io.Writer
+}
+
+func (p *textPlanWriter) write(f *plannedFile) error {
+	_, err := fmt.Fprintln(p.w, f.URL)
+	return err
+}
+
+func (p *textPlanWriter) close() error {
+	return nil
+}
+
+// aria2c --input-file format, the post is kept in a comment since aria2 can't set file times
+type aria2PlanWriter struct {
+	w io.Writer
+}
+
+func (p *aria2PlanWriter) write(f *plannedFile) error {
+	dir, out := filepath.Split(f.Path)
+
+	_, err := fmt.Fprintf(p.w, "# post %d %s\n%s\n  dir=%s\n  out=%s\n", f.PostID, f.Timestamp.Format(time.RFC3339), f.URL, filepath.Clean(dir), out)
+	return err
+}
+
+func (p *aria2PlanWriter) close() error {
+	return nil
+}
+
+// collects everything a dry run found
+type plan struct {
+	// accessed atomically, kept first for alignment
+	files int64
+	bytes int64
+
+	lock   sync.Mutex
+	writer planWriter
+
+	estimate bool
+}
+
+// closes the writer and logs what the dry run found, err is what the scrape returned
+func (p *plan) finish(link string, err error) error {
+	if p == nil {
+		return err
+	}
+
+	if e := p.writer.close(); err == nil {
+		err = e
+	}
+
+	if p.estimate {
+		log.Printf("%s: dry run found %d files, %d bytes in total", link, p.files, p.bytes)
+	} else {
+		log.Printf("%s: dry run found %d files", link, p.files)
+	}
+
+	return err
+}
+
+func (p *plan) add(f *plannedFile) error {
+	atomic.AddInt64(&p.files, 1)
+	atomic.AddInt64(&p.bytes, f.Size)
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.writer.write(f)
+}
+
+func (sc *scrapeContext) planFileAsync(post *post, rawURL string) error {
+	if !sc.plan.estimate {
+		return sc.plan.add(sc.planFile(post, rawURL, nil))
+	}
+
+	sc.sema.Acquire(int(sc.offset))
+
+	sc.errgroup.Go(func() error {
+		defer sc.sema.Release()
+
+		// an estimate that's missing a size beats no plan at all
+		res, err := sc.headFile(rawURL)
+		if err != nil {
+			if sc.ctx.Err() != nil {
+				return err
+			}
+			log.Printf("%s: HEAD %s failed, listing it without a size: %v", sc.link, rawURL, err)
+		}
+
+		return sc.plan.add(sc.planFile(post, rawURL, res))
+	})
+
+	return nil
+}
+
+// res is optional, but lets us know the actual size and name of the file
+func (sc *scrapeContext) planFile(post *post, rawURL string, res *http.Response) *plannedFile {
+	optimalRawURL := sc.guessURL(rawURL)
+
+	f := &plannedFile{
+		PostID:    post.id,
+		Timestamp: post.timestamp(),
+		URL:       optimalRawURL,
+		Path:      filepath.Join(sc.config.Save, filepath.Base(optimalRawURL)),
+	}
+
+	if res != nil {
+		f.URL = res.Request.URL.String()
+		f.Path = sc.fixupFilePath(res, filepath.Join(sc.config.Save, filepath.Base(f.URL)))
+		if res.ContentLength > 0 {
+			f.Size = res.ContentLength
+		}
+	}
+
+	return f
+}
+
+// like downloadFile, tries the largest variant before the original URL
+func (sc *scrapeContext) headFile(rawURL string) (*http.Response, error) {
+	r := sc.resolveURL(rawURL)
+	if r.head != nil {
+		return r.head, nil
+	}
+
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := sc.doRequest(http.MethodHead, u, sc.mediaHeader(""))
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		log.Printf("%s: HEAD %s failed with: %s, listing it without a size", sc.link, rawURL, res.Status)
+		return nil, nil
+	}
+
+	return res, nil
+}
@@ -0,0 +1,73 @@
+package scraper
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// an estimating dry run of posts with one image each, where the HEAD of one of them fails with status
+func planWithBrokenHEAD(t *testing.T, format string, status int) {
+	const top = 1500000000
+
+	posts := postsFrom(1, top, 10)
+	for i := range posts {
+		posts[i].Image = fmt.Sprintf("%d.jpg", posts[i].ID)
+	}
+
+	api := &fakeAPI{posts: posts}
+	api.setMedia(posts[4].Image, status)
+
+	ts := newTestScraper(t, api)
+	defer ts.close()
+
+	var buf bytes.Buffer
+	ts.scrape(t, &Options{Plan: &buf, PlanFormat: format, Estimate: true})
+
+	var files []plannedFile
+	if format == PlanJSON {
+		err := json.Unmarshal(buf.Bytes(), &files)
+		if err != nil {
+			t.Fatalf("the plan isn't valid JSON: %v\n%s", err, buf.Bytes())
+		}
+	} else {
+		s := bufio.NewScanner(&buf)
+		for s.Scan() {
+			var f plannedFile
+			err := json.Unmarshal(s.Bytes(), &f)
+			if err != nil {
+				t.Fatalf("%q isn't valid JSON: %v", s.Text(), err)
+			}
+			files = append(files, f)
+		}
+	}
+
+	listed := make(map[int64]plannedFile)
+	for _, f := range files {
+		listed[f.PostID] = f
+	}
+
+	for _, p := range posts {
+		f, ok := listed[p.ID]
+		if !ok {
+			t.Errorf("post %d isn't in the plan", p.ID)
+			continue
+		}
+
+		if want := p.ID != posts[4].ID; (f.Size > 0) != want {
+			t.Errorf("post %d has size %d, want one: %v", p.ID, f.Size, want)
+		}
+	}
+}
+
+func TestDryRunFailedHEAD(t *testing.T) {
+	planWithBrokenHEAD(t, PlanJSONL, dropConnection)
+}
+
+func TestExportFailedHEAD(t *testing.T) {
+	// a json export that's cut short doesn't parse at all
+	planWithBrokenHEAD(t, PlanJSON, http.StatusInternalServerError)
+}
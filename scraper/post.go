@@ -0,0 +1,210 @@
+package scraper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/soeux/tumtum/blogid"
+	"github.com/soeux/tumtum/config"
+)
+
+var errPostNotFound = errors.New("post not found")
+
+// scrapes single posts, which neither resume from nor move the cursor of their blogs
+// posts that fail are logged and skipped, the error says how many there were
+func (s *Scraper) ScrapePosts(ctx context.Context, posts []blogid.Identifier, cfg *config.Config, opts *Options) error {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	p, err := prepare(cfg, opts)
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, id := range posts {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+			break
+		}
+		// a hook that aborts failed
+		if s.hooks.Err() != nil {
+			break
+		}
+
+		e := s.run(ctx, id.Blog, cfg, opts, p, func(sc *scrapeContext) error {
+			return sc.scrapeSingle(id.PostID)
+		})
+		if e == errStopped {
+			break
+		}
+		if e != nil {
+			if isCanceled(ctx, e) {
+				err = e
+				break
+			}
+
+			log.Printf("%s: failed to scrape post %d: %v", id.Blog, id.PostID, e)
+			failed++
+		}
+	}
+
+	if err == nil && failed != 0 {
+		err = fmt.Errorf("failed to scrape %d of %d posts", failed, len(posts))
+	}
+
+	return p.finish("posts", err)
+}
+
+// fetches the post through the api and scrapes it like any other, except that known posts are scraped again
+func (sc *scrapeContext) scrapeSingle(id int64) (err error) {
+	sc.persist = false
+	sc.resolveBlog()
+
+	defer func() {
+		e := sc.errgroup.Wait()
+		if err == nil {
+			err = e
+		}
+	}()
+
+	if sc.stopping() {
+		return errStopped
+	}
+
+	post, err := sc.fetchPost(id)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("%s: scraping post %d from %v", sc.link, post.id, post.timestamp().Format("2Jan06 15:04:05"))
+
+	// it wouldn't be in a page of posts, so it doesn't matter where the cursor is
+	post.pending.outOfOrder = true
+
+	return sc.scrapePostTracked(post)
+}
+
+func (sc *scrapeContext) fetchPost(id int64) (*post, error) {
+	sc.sema.Acquire(0)
+	defer sc.sema.Release()
+
+	u := sc.getAPIPostURL(id)
+
+	res, err := sc.doGetRequest(u, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		// continue
+	case http.StatusNotFound:
+		return nil, errPostNotFound
+	default:
+		return nil, fmt.Errorf("GET %s failed with: %d %s", u, res.StatusCode, res.Status)
+	}
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &postsResponse{}
+	err = json.Unmarshal(body, data)
+	if err != nil {
+		return nil, err
+	}
+
+	atomic.AddInt64(&sc.scraper.stats.Pages, 1)
+
+	for _, p := range data.Response.Posts {
+		p.id, err = p.ID.Int64()
+		if err != nil {
+			return nil, err
+		}
+
+		if p.id == id {
+			return p, nil
+		}
+	}
+
+	return nil, errPostNotFound
+}
+
+func (sc *scrapeContext) getAPIPostURL(id int64) *url.URL {
+	u, err := url.Parse(fmt.Sprintf("%s/blog/%s/posts", sc.scraper.apiBase, sc.link))
+	if err != nil {
+		panic(err)
+	}
+
+	u.RawQuery = url.Values{
+		"api_key": {sc.config.APIKey},
+		"id":      {strconv.FormatInt(id, 10)},
+		"npf":     {"true"},
+	}.Encode()
+
+	return u
+}
+
+// what's saved next to the media of a post, in meta/<blog>/<id>.json
+type postMeta struct {
+	Blog      string           `json:"blog"`
+	ID        int64            `json:"id"`
+	Timestamp int64            `json:"timestamp"`
+	ScrapedAt time.Time        `json:"scraped_at"`
+	Files     []postFile       `json:"files"`
+	External  []*externalEmbed `json:"external,omitempty"`
+	Post      json.RawMessage  `json:"post"`
+}
+
+// a file of a post, and which of its sizes we got
+type postFile struct {
+	URL        string `json:"url"`
+	Resolved   string `json:"resolved_url"`
+	Resolution string `json:"resolution,omitempty"`
+}
+
+func (p *post) addFile(rawURL string, r resolution) {
+	p.metaLock.Lock()
+	defer p.metaLock.Unlock()
+
+	p.files = append(p.files, postFile{URL: rawURL, Resolved: r.URL, Resolution: r.Size})
+}
+
+func (sc *scrapeContext) writePostMeta(p *post) error {
+	dir := filepath.Join(sc.config.Save, "meta", sc.blog)
+
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(&postMeta{
+		Blog:      sc.blog,
+		ID:        p.id,
+		Timestamp: p.Timestamp,
+		ScrapedAt: time.Now(),
+		Files:     p.files,
+		External:  p.external,
+		Post:      p.raw,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(dir, strconv.FormatInt(p.id, 10)+".json"), data, 0644)
+}
@@ -0,0 +1,206 @@
+package scraper
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// a way tumblr encodes the size of media in its URLs
+type urlScheme struct {
+	name string
+	// the first submatch is the size, which is swapped out for the others
+	re *regexp.Regexp
+	// sizes that exist in this scheme, largest first
+	sizes []string
+	// whether the largest size is a safe bet without asking, which is how dry runs without --estimate pick
+	guess bool
+}
+
+var (
+	sizeWidthRegexp = regexp.MustCompile(`\d+`)
+
+	urlSchemes = []*urlScheme{
+		// https://64.media.tumblr.com/<hash>/<hash>-<ext>/s640x960/<hash>.jpg
+		{
+			name:  "sized",
+			re:    regexp.MustCompile(`/(s\d+x\d+(?:_c\d+)?)/[^/]+$`),
+			sizes: []string{"s2048x3072", "s1280x1920", "s640x960", "s540x810", "s500x750", "s400x600", "s250x400", "s100x200"},
+		},
+		// https://64.media.tumblr.com/<hash>/tumblr_<id>_500.jpg
+		{
+			name:  "legacy",
+			re:    regexp.MustCompile(`(_(?:\d+|75sq))\.[a-z]+$`),
+			sizes: []string{"_1280", "_640", "_540", "_500", "_400", "_250", "_100"},
+			guess: true,
+		},
+		// https://vt.tumblr.com/tumblr_<id>_480.mp4, where no suffix is the original
+		{
+			name:  "video",
+			re:    regexp.MustCompile(`(_(?:480|720))\.mp4$`),
+			sizes: []string{"", "_720", "_480"},
+			guess: true,
+		},
+	}
+)
+
+// widths, so sizes of a scheme can be compared, no size at all is the original and beats everything
+func sizeWidth(size string) int {
+	digits := sizeWidthRegexp.FindString(size)
+	if len(digits) == 0 {
+		return int(^uint(0) >> 1)
+	}
+
+	w, _ := strconv.Atoi(digits)
+	return w
+}
+
+// sizes as they show up in the log and post metadata
+func sizeLabel(size string) string {
+	if len(size) == 0 {
+		return "original"
+	}
+	return strings.TrimPrefix(size, "_")
+}
+
+// which size worked for URLs of a scheme and size, so the next one like it can try that first
+type resolver struct {
+	lock    sync.Mutex
+	winners map[string]string
+}
+
+func (r *resolver) winner(pattern string) (string, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	size, ok := r.winners[pattern]
+	return size, ok
+}
+
+func (r *resolver) remember(pattern, size string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.winners == nil {
+		r.winners = make(map[string]string)
+	}
+	r.winners[pattern] = size
+}
+
+// where a media URL ended up
+type resolution struct {
+	URL string
+	// the size picked from the URL's scheme, empty if the URL was used as is
+	Size string
+	// the successful HEAD request, if there was one
+	head *http.Response
+}
+
+// larger variants of rawURL, largest first, and the key for caching which one worked
+func candidateURLs(rawURL string) (candidates []string, sizes []string, pattern string, guess bool) {
+	for _, s := range urlSchemes {
+		m := s.re.FindStringSubmatchIndex(rawURL)
+		if m == nil {
+			continue
+		}
+
+		current := rawURL[m[2]:m[3]]
+		for _, size := range s.sizes {
+			if sizeWidth(size) <= sizeWidth(current) {
+				break
+			}
+
+			candidates = append(candidates, rawURL[:m[2]]+size+rawURL[m[3]:])
+			sizes = append(sizes, size)
+		}
+
+		return candidates, sizes, s.name + "|" + current, s.guess
+	}
+
+	return nil, nil, "", false
+}
+
+// finds the largest variant of rawURL that exists, with HEAD requests, largest first
+// falls back to rawURL itself, which is what the api gave us and should always work
+func (sc *scrapeContext) resolveURL(rawURL string) resolution {
+	candidates, sizes, pattern, _ := candidateURLs(rawURL)
+	if len(candidates) == 0 {
+		return resolution{URL: rawURL}
+	}
+
+	// whatever worked for the last URL like this one most likely works for this one too
+	if size, ok := sc.scraper.resolver.winner(pattern); ok {
+		for i := range sizes {
+			if sizes[i] != size {
+				continue
+			}
+
+			res, ok := sc.probe(candidates[i])
+			if ok {
+				log.Printf("%s: resolved %s to %s", sc.link, rawURL, sizeLabel(size))
+				return resolution{URL: candidates[i], Size: sizeLabel(size), head: res}
+			}
+			break
+		}
+	}
+
+	for i, candidate := range candidates {
+		res, ok := sc.probe(candidate)
+		if !ok {
+			continue
+		}
+
+		sc.scraper.resolver.remember(pattern, sizes[i])
+		log.Printf("%s: resolved %s to %s", sc.link, rawURL, sizeLabel(sizes[i]))
+		return resolution{URL: candidate, Size: sizeLabel(sizes[i]), head: res}
+	}
+
+	return resolution{URL: rawURL}
+}
+
+// like resolveURL, but without any requests, for dry runs that aren't supposed to make any
+func (sc *scrapeContext) guessURL(rawURL string) string {
+	candidates, sizes, pattern, guess := candidateURLs(rawURL)
+
+	if size, ok := sc.scraper.resolver.winner(pattern); ok {
+		for i := range sizes {
+			if sizes[i] == size {
+				return candidates[i]
+			}
+		}
+	}
+
+	if guess && len(candidates) != 0 {
+		return candidates[0]
+	}
+
+	return rawURL
+}
+
+// HEADs rawURL, returns false if it's not there
+// servers that don't do HEAD get the benefit of the doubt, downloadFile falls back to the original URL anyway
+func (sc *scrapeContext) probe(rawURL string) (*http.Response, bool) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, false
+	}
+
+	res, err := sc.doRequest(http.MethodHead, u, sc.mediaHeader(""))
+	if err != nil {
+		return nil, false
+	}
+	res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		return res, true
+	case http.StatusMethodNotAllowed, http.StatusNotImplemented:
+		return nil, true
+	default:
+		return nil, false
+	}
+}
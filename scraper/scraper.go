@@ -16,23 +16,30 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/soeux/tumtum/config"
 	"github.com/soeux/tumtum/database"
+	"github.com/soeux/tumtum/hooks"
 	"github.com/soeux/tumtum/semaphore"
+	"github.com/soeux/tumtum/webhook"
 	"golang.org/x/sync/errgroup"
 )
 
+const apiBaseURL = "https://api.tumblr.com/v2"
+
 var (
 	errFileNotFound = errors.New("file not found")
+	// the file was left out by mime_allow, mime_deny or max_file_size
+	errSkipped = errors.New("skipped")
+	// returned when Options.Stop closes halfway through a post
+	errStopped = errors.New("stopped")
 
 	deactivatedNameSuffixLength = 20
 	deactivatedNameRegexp       = regexp.MustCompile(`.-deactivated\d{8}$`)
 
-	videoURLFixupRegexp  = regexp.MustCompile(`_(?:480|720)\.mp4$`)
-	imageSizeFixupRegexp = regexp.MustCompile(`_(?:\d+)\.([a-z]+)$`)
-
 	mediaURLRegexp     = regexp.MustCompile(`^http.+(?:media|vtt)\.tumblr\.com/.+$`)
 	htmlMediaURLRegexp = regexp.MustCompile(`http[^"]+(?:media|vtt)\.tumblr\.com/[^"]+`)
 )
@@ -56,79 +63,292 @@ func init() {
 
 // scraper object
 type Scraper struct {
-	client *http.Client
-	config *config.Config
-	db     *database.Database
+	// accessed atomically, kept first for alignment
+	stats Stats
+	// set once the quota-exhausted webhook went out
+	quotaSent int32
+
+	client   *http.Client
+	config   *config.Config
+	db       *database.Database
+	resolver resolver
+	hooks    *hooks.Runner
+	webhooks *webhook.Notifier
+	// apiBaseURL, unless tests point it somewhere else
+	apiBase string
+
+	// for Status and TogglePause
+	lock     sync.Mutex
+	current  *scrapeContext
+	paused   bool
+	stopping bool
 }
 
 // initalising a scraper obj
 func NewScraper(client *http.Client, config *config.Config, database *database.Database) *Scraper {
 	return &Scraper{
-		client: client,
-		config: config,
-		db:     database,
+		client:   client,
+		config:   config,
+		db:       database,
+		hooks:    hooks.New(config),
+		webhooks: webhook.New(client, config),
+		apiBase:  apiBaseURL,
+	}
+}
+
+// per-run settings that don't belong in tumtum.toml
+type Options struct {
+	// only posts published in [Since, Until) are scraped
+	// bounded runs don't touch the resume cursor in the db
+	Since time.Time
+	Until time.Time
+
+	// if set, nothing is downloaded, and media is listed to Plan in PlanFormat instead
+	// this is how both dry runs and exports work, and neither touches the resume cursor in the db
+	Plan       io.Writer
+	PlanFormat string
+	// send HEAD requests for planned files to find out their size
+	Estimate bool
+
+	// start from the newest post and stop at the first page of posts that were all scraped before
+	// the cursor of the full backfill isn't touched
+	Sync bool
+
+	// once closed, no new pages are fetched and no new downloads queued,
+	// but the ones in flight get to finish unless ctx is canceled too
+	Stop <-chan struct{}
+}
+
+func (o *Options) bounded() bool {
+	return !o.Since.IsZero() || !o.Until.IsZero()
+}
+
+func (o *Options) dryRun() bool {
+	return o.Plan != nil
+}
+
+// whether Stop was closed
+func (o *Options) stopped() bool {
+	select {
+	case <-o.Stop:
+		return true
+	default:
+		return false
 	}
 }
 
 // creating the save location + starting a child process for scraper
-func (s *Scraper) Scrape(ctx context.Context, link string, cfg *config.Config) (time.Time, int64, error) {
-	err := os.MkdirAll(cfg.Save, 0755)
+func (s *Scraper) Scrape(ctx context.Context, link string, cfg *config.Config, opts *Options) error {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	p, err := prepare(cfg, opts)
 	if err != nil {
-		return time.Time{}, 0, err
+		return err
 	}
 
+	err = s.run(ctx, link, cfg, opts, p, func(sc *scrapeContext) (err error) {
+		defer func() { sc.fireBlogDone(err) }()
+
+		err = sc.loadBlogInfo()
+		if err == errUpToDate {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		err = sc.Scrape()
+		// a sync with failed files isn't done, the next one has to get past the blog being unchanged
+		if err == nil && sc.sync && !sc.stopping() && atomic.LoadInt64(&sc.failures) == 0 {
+			sc.markSynced()
+		}
+		return err
+	})
+
+	return p.finish(link, err)
+}
+
+// creates the save location, or the plan for dry runs, which is nil otherwise
+func prepare(cfg *config.Config, opts *Options) (*plan, error) {
+	if opts.dryRun() {
+		w, err := newPlanWriter(opts.Plan, opts.PlanFormat)
+		if err != nil {
+			return nil, err
+		}
+
+		return &plan{writer: w, estimate: opts.Estimate}, nil
+	}
+
+	return nil, os.MkdirAll(cfg.Save, 0755)
+}
+
+// runs fn on a new scrapeContext for link, which Status and TogglePause see as the current one
+func (s *Scraper) run(ctx context.Context, link string, cfg *config.Config, opts *Options, p *plan, fn func(sc *scrapeContext) error) error {
+	runCtx := ctx
 	eg, ctx := errgroup.WithContext(ctx)
 
-	sc := newScrapeContext(s, cfg, link, eg, ctx)
+	sc := newScrapeContext(s, cfg, opts, link, eg, ctx)
+	sc.runCtx = runCtx
+	sc.plan = p
 
-	err = sc.Scrape()
-	if err != nil {
-		return time.Time{}, 0, err
+	s.lock.Lock()
+	s.current = sc
+	if s.paused {
+		sc.sema.Pause()
 	}
+	s.lock.Unlock()
+
+	defer func() {
+		s.lock.Lock()
+		s.current = nil
+		s.lock.Unlock()
+	}()
+
+	// whatever is waiting on a paused semaphore would never notice ^C, so stopping resumes it
+	done := make(chan struct{})
+	defer close(done)
 
-	return sc.timeObj, sc.offset, nil
+	go func() {
+		select {
+		case <-opts.Stop:
+		case <-runCtx.Done():
+		case <-done:
+			return
+		}
+		s.resume()
+	}()
+
+	return fn(sc)
 }
 
 type scrapeContext struct {
+	// files that failed in this scrape, accessed atomically, kept first for alignment
+	failures int64
+
 	// structuralised arguments
-	scraper  *Scraper
-	config   *config.Config
-	link     string
+	scraper *Scraper
+	config  *config.Config
+	link    string
+	// what the blog's posts, info and metadata are kept under, see resolveBlog
+	blog     string
 	errgroup *errgroup.Group
 	ctx      context.Context
+	// outlives ctx, which ends with the errgroup, so hooks that are still running don't get killed with it
+	runCtx context.Context
 
 	// current pagination state
-	timeObj time.Time
-	timeNew bool // true if we're starting on a blog for the first time, false if there's a time in the db
-	offset  int64
+	timeObj  time.Time
+	timeNew  bool // true if we're starting on a blog for the first time, false if there's a time in the db
+	offset   int64
+	boundary boundary
+	// ids of pinned and other out of order posts, which don't move the cursor
+	outOfOrder map[int64]struct{}
+
+	// lower bound, posts older than this end the scrape
+	since time.Time
+	// upper bound, exclusive, only out of order posts can be past it since the cursor starts below it
+	until time.Time
+	// see Options.Sync
+	sync bool
+	// false if the pagination state shouldn't be saved to the db
+	persist bool
+	// start where the last backfill of the blog left off
+	resume bool
+	// non-nil during dry runs
+	plan *plan
+	// serializes writes to meta/<blog>/external.jsonl
+	externalLock sync.Mutex
+	// what's in external.jsonl already, loaded on the first write
+	externalSeen map[string]struct{}
+	// from /blog/{blog}/info, nil during dry runs
+	info       *database.BlogInfo
+	totalPosts int64
+	// what's safe to save as the cursor
+	watermark watermark
+	// see Options.Stop
+	stop <-chan struct{}
+	// for Scraper.Status
+	cursorUnix int64
+	inFlight   inFlight
 
 	// other private members
 	sema *semaphore.PrioritySemaphore
 }
 
-func newScrapeContext(s *Scraper, cfg *config.Config, link string, eg *errgroup.Group, ctx context.Context) *scrapeContext {
+func newScrapeContext(s *Scraper, cfg *config.Config, opts *Options, link string, eg *errgroup.Group, ctx context.Context) *scrapeContext {
 	// initalising a scrapeContext
 	sc := &scrapeContext{
 		scraper:  s,
 		config:   cfg,
 		link:     link,
+		blog:     link,
 		errgroup: eg,
 		ctx:      ctx,
 		timeObj:  time.Time{}, // if this is left alone, the scraper will not work
 		timeNew:  false,
 		offset:   0,
+		since:    opts.Since,
+		until:    opts.Until,
+		persist:  !opts.bounded() && !opts.dryRun() && !opts.Sync,
+		sync:     opts.Sync,
+		stop:     opts.Stop,
 		sema:     semaphore.NewPrioritySemaphore(s.config.Concurrency),
 	}
 
+	sc.watermark.onSettled = sc.postSettled
+
+	// a bounded run is a window into the blog, so it neither resumes from nor moves the backfill cursor
+	// neither does a sync, which always starts at the top
+	if opts.bounded() || opts.Sync {
+		// pages include the cursor's second, and until is exclusive
+		sc.timeObj = opts.Until.Add(-time.Second)
+		if opts.Until.IsZero() {
+			sc.timeObj = time.Now()
+		}
+		sc.cursorUnix = sc.timeObj.Unix()
+		return sc
+	}
+
+	// the cursor is per blog, which is only known for sure after loadBlogInfo, see loadCursor
+	sc.resume = true
+	sc.timeObj = time.Now()
+	sc.cursorUnix = sc.timeObj.Unix()
+	return sc
+}
+
+// picks up where the last backfill of sc.blog left off
+// dbs from before cursors were per blog have a single one, which goes to the first blog scraped without one of its own
+func (sc *scrapeContext) adoptLegacyCursor() {
+	// dry runs don't change the db
+	if sc.plan != nil {
+		return
+	}
+
+	c, ok, err := sc.scraper.db.AdoptLegacyCursor(sc.blog)
+	if err != nil {
+		log.Printf("%s: error adopting the old cursor from db: %v", sc.link, err)
+		return
+	}
+
+	if ok {
+		log.Printf("%s: picking up the cursor from before cursors were per blog, %d posts seen", sc.link, c.Offset)
+	}
+}
+
+func (sc *scrapeContext) loadCursor() {
+	sc.adoptLegacyCursor()
+
 	// if there's an offset in the db use that
-	if o, err := s.db.GetOffset(link); err != nil {
-		log.Printf("error loading offset from db: %v", err)
+	if o, err := sc.scraper.db.GetOffset(sc.blog); err != nil {
+		log.Printf("%s: error loading offset from db: %v", sc.link, err)
 	} else {
 		sc.offset = o
 	}
 
-	if t, err := s.db.GetTime(link); err != nil {
-		log.Printf("error loading time from db: %v", err)
+	if t, err := sc.scraper.db.GetTime(sc.blog); err != nil {
+		log.Printf("%s: error loading time from db: %v", sc.link, err)
 	} else {
 		// time.Time{} -> 0001-01-01 00:00:00 +0000 UTC
 		// if there's no time then the time is now
@@ -142,16 +362,27 @@ func newScrapeContext(s *Scraper, cfg *config.Config, link string, eg *errgroup.
 		}
 	}
 
-	return sc
+	atomic.StoreInt64(&sc.cursorUnix, sc.timeObj.Unix())
 }
 
 func (sc *scrapeContext) Scrape() (err error) {
+	if sc.resume {
+		sc.loadCursor()
+	}
+
 	log.Printf("%s: scraping starting at %v", sc.link, sc.timeObj.Format("2Jan06 15:04:05"))
 	defer func() {
 		log.Printf("%s: scraping finished at %v", sc.link, sc.timeObj.Format("2Jan06 15:04:05"))
 
+		if !sc.persist {
+			return
+		}
+
 		// so it seems when the program gets ^C, it doesn't go back to downloader.go so we have to save the time here
-		err := sc.scraper.db.SetTime(sc.timeObj)
+		// only posts whose downloads are all settled count, see watermark
+		sc.checkpoint()
+
+		err := sc.scraper.db.SetOffset(sc.blog, sc.offset)
 		if err != nil {
 			log.Println(err)
 		}
@@ -159,15 +390,31 @@ func (sc *scrapeContext) Scrape() (err error) {
 
 	defer func() {
 		e := sc.errgroup.Wait()
-		if err != nil {
+		if err == nil {
 			err = e
 		}
 	}()
 
+	defer func() {
+		if err == errStopped {
+			log.Printf("%s: stopping, waiting for downloads in progress", sc.link)
+			err = nil
+		}
+	}()
+
+	done := make(chan struct{})
+	defer close(done)
+	go sc.checkpointLoop(done)
+
 	// startTime := sc.timeObj
 
 	for {
-		log.Printf("%s: fetching posts before %v", sc.link, sc.timeObj.Format("2Jan06 15:04:05"))
+		if sc.stopping() {
+			err = errStopped
+			return
+		}
+
+		log.Printf("%s: fetching posts before %v%s", sc.link, sc.timeObj.Format("2Jan06 15:04:05"), sc.progress())
 
 		var res *postsResponse
 		res, err = sc.scrapeBlog()
@@ -189,29 +436,98 @@ func (sc *scrapeContext) Scrape() (err error) {
 			}
 		}
 
+		fresh := 0
+		unknown := 0
+
 		// how we're going to keep track of the times and scraping a post
 		for _, post := range res.Response.Posts {
-			// check if this post has an older time than the one we have on hand
-			if sc.timeObj.Sub(post.timestamp()) >= 0 {
-				// positive, so it's older than what we have in timeObj
-				// we're keeping the post's time
-				sc.timeObj = post.timestamp()
-				// log.Printf("time was positive: %v", sc.timeObj.Sub(post.timestamp()))
-			} else {
-				// negative, so the post's time is more recent than the one on hand
+			// pinned posts show up on top no matter how old they are, so they can't move the cursor
+			// neither can posts that are somehow newer than it, e.g. because they were edited
+			if post.IsPinned || sc.timeObj.Sub(post.timestamp()) < 0 {
+				if sc.seenOutOfOrder(post) || sc.outsideBounds(post) {
+					continue
+				}
+
+				post.pending.outOfOrder = true
+				sc.checkKnown(post)
+
+				err = sc.scrapePostTracked(post)
+				if err != nil {
+					return
+				}
+				continue
+			}
+
+			// everything from here on is older than the lower bound
+			if sc.beforeSince(post) {
 				return
 			}
 
-			err = sc.scrapePost(post)
+			// positive or zero, so it's at least as old as what we have in timeObj
+			// we're keeping the post's time, unless we've seen the post already
+			if !sc.advanceCursor(post) {
+				continue
+			}
+			fresh++
+
+			sc.checkKnown(post)
+			if !post.known {
+				unknown++
+			}
+
+			err = sc.scrapePostTracked(post)
 			if err != nil {
 				return
 			}
 		}
 
-		sc.offset += int64(len(res.Response.Posts))
+		// everything from here on was scraped by an earlier run
+		// a page of nothing but repeats from the cursor's second says nothing about that,
+		// and edited posts can be anywhere, so looking for them means going through the whole blog
+		if sc.sync && fresh != 0 && unknown == 0 && !sc.config.ReprocessChanged {
+			log.Printf("%s: caught up with earlier scrapes", sc.link)
+			return
+		}
+
+		sc.offset += int64(fresh)
+		if !sc.pageDone(len(res.Response.Posts), fresh) {
+			return
+		}
 	}
 }
 
+// scrapes the post with the watermark keeping track of its downloads
+// a post that's interrupted by Options.Stop never gets sealed, so the cursor stays in front of it
+func (sc *scrapeContext) scrapePostTracked(post *post) error {
+	sc.watermark.begin(post)
+
+	// known posts only go through the watermark for the sake of the cursor
+	if post.known {
+		sc.watermark.seal(post)
+		atomic.AddInt64(&sc.scraper.stats.PostsKnown, 1)
+		return nil
+	}
+
+	err := sc.scrapePost(post)
+	if err != nil {
+		return err
+	}
+
+	sc.watermark.seal(post)
+	atomic.AddInt64(&sc.scraper.stats.Posts, 1)
+	return nil
+}
+
+// posts before Options.Since
+func (sc *scrapeContext) beforeSince(post *post) bool {
+	return !sc.since.IsZero() && post.timestamp().Before(sc.since)
+}
+
+// posts outside of [Options.Since, Options.Until)
+func (sc *scrapeContext) outsideBounds(post *post) bool {
+	return sc.beforeSince(post) || (!sc.until.IsZero() && !post.timestamp().Before(sc.until))
+}
+
 func (sc *scrapeContext) scrapeBlog() (data *postsResponse, err error) {
 	for data == nil {
 		data, err = sc.scrapeBlogMaybe()
@@ -255,20 +571,32 @@ func (sc *scrapeContext) scrapeBlogMaybe() (*postsResponse, error) {
 		return nil, err
 	}
 
+	atomic.AddInt64(&sc.scraper.stats.Pages, 1)
 	return data, nil
 }
 
 func (sc *scrapeContext) scrapePost(post *post) error {
+	if !sc.wantPost(post) {
+		return nil
+	}
+
 	// NPF post
-	err := sc.scrapeNPFContent(post, post.Content)
-	if err != nil {
-		return err
+	if sc.wantOwnContent(post) {
+		err := sc.scrapeNPFContent(post, post.Content)
+		if err != nil {
+			return err
+		}
 	}
 
 	// actually get the content
-	for _, t := range post.Trail {
+	for i := range post.Trail {
+		t := &post.Trail[i]
+		if !sc.wantTrailEntry(t) {
+			continue
+		}
+
 		var cs []content
-		err = json.Unmarshal(t.Content, &cs)
+		err := json.Unmarshal(t.Content, &cs)
 		if err != nil {
 			continue
 		}
@@ -283,43 +611,69 @@ func (sc *scrapeContext) scrapePost(post *post) error {
 }
 
 func (sc *scrapeContext) scrapeNPFContent(post *post, cs []content) error {
-	for _, c := range cs {
-		// check if this post even has something to download
-		if len(c.Media) == 0 {
-			continue
-		}
+	for i := range cs {
+		c := &cs[i]
 
 		switch c.Type {
 		case "image":
+			// check if this post even has something to download
+			if len(c.Media) == 0 {
+				continue
+			}
+
 			var ms imageMedia
 			err := json.Unmarshal(c.Media, &ms)
 			if err != nil {
 				return err
 			}
 
-			bestURL := ms[0].URL
-			bestArea := ms[0].Width * ms[0].Height
+			if len(ms) == 0 {
+				continue
+			}
 
-			for _, m := range ms {
-				if m.HasOriginalDimensions {
-					bestURL = m.URL
-					break
-				}
-				if m.Width*m.Height > bestArea {
-					bestURL = m.URL
-				}
+			best := ms.best()
+
+			if !sc.wantMediaKind(imageKind(best.URL, best.Type)) || !sc.wantImageSize(best.Width, best.Height) {
+				continue
 			}
 
-			sc.downloadFileAsync(post, bestURL)
+			err = sc.queueFile(post, best.URL)
+			if err != nil {
+				return err
+			}
 		case "video":
-			var ms videoMedia
+			err := sc.scrapeVideo(post, c)
+			if err != nil {
+				return err
+			}
+		case "link":
+			sc.recordExternal(post, c)
+
+			err := sc.queuePoster(post, c)
+			if err != nil {
+				return err
+			}
+		case "audio":
+			if len(c.Media) == 0 {
+				continue
+			}
+
+			var ms audioMedia
 			err := json.Unmarshal(c.Media, &ms)
 			if err != nil {
 				return err
 			}
 
+			if !sc.wantMediaKind(config.MediaAudio) {
+				continue
+			}
+
+			// spotify, soundcloud etc. embeds aren't hosted by tumblr
 			if strings.Contains(ms.URL, "tumblr.com") {
-				sc.downloadFileAsync(post, ms.URL)
+				err = sc.queueFile(post, ms.URL)
+				if err != nil {
+					return err
+				}
 			}
 		}
 	}
@@ -327,7 +681,34 @@ func (sc *scrapeContext) scrapeNPFContent(post *post, cs []content) error {
 	return nil
 }
 
-func (sc *scrapeContext) downloadFileAsync(post *post, rawurl string) {
+// dry runs only list what would be downloaded
+func (sc *scrapeContext) queueFile(post *post, rawurl string) error {
+	if sc.stopping() {
+		return errStopped
+	}
+
+	if sc.plan != nil {
+		return sc.planFileAsync(post, rawurl)
+	}
+
+	return sc.downloadFileAsync(post, rawurl)
+}
+
+// also true once a hook that aborts failed
+func (sc *scrapeContext) stopping() bool {
+	if sc.scraper.hooks.Err() != nil {
+		return true
+	}
+
+	select {
+	case <-sc.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+func (sc *scrapeContext) downloadFileAsync(post *post, rawurl string) error {
 	if len(rawurl) == 0 {
 		// lol how did we get here
 		panic("missing url")
@@ -335,35 +716,99 @@ func (sc *scrapeContext) downloadFileAsync(post *post, rawurl string) {
 
 	sc.sema.Acquire(int(sc.offset))
 
+	// we might've been waiting on the semaphore for a while
+	if sc.stopping() {
+		sc.sema.Release()
+		return errStopped
+	}
+
+	sc.watermark.queued(post)
+
 	sc.errgroup.Go(func() error {
 		defer sc.sema.Release()
-		return sc.downloadFile(post, rawurl)
+
+		sc.inFlight.add(rawurl)
+		err := sc.downloadFile(post, rawurl)
+		sc.inFlight.remove(rawurl)
+		if err != nil {
+			return err
+		}
+
+		sc.watermark.finished(post)
+		return nil
 	})
+
+	return nil
 }
 
 func (sc *scrapeContext) downloadFile(post *post, rawURL string) error {
-	optimalRawURL := sc.fixupURL(rawURL)
+	var (
+		r   resolution
+		err error
+	)
 
-	// first try to use the optimal URL, if that doesn't work then fall back on the original
-	err := sc.downloadFileMaybe(post, optimalRawURL)
-	if err == errFileNotFound && optimalRawURL != rawURL {
-		err = sc.downloadFileMaybe(post, rawURL)
+	if isHLSURL(rawURL) {
+		r = resolution{URL: rawURL}
+		err = sc.downloadHLS(post, rawURL)
+	} else {
+		r = sc.resolveURL(rawURL)
+
+		// first try the largest variant, if that doesn't work then fall back on the original
+		err = sc.downloadFileMaybe(post, r.URL)
+		if err == errFileNotFound && r.URL != rawURL {
+			r = resolution{URL: rawURL}
+			err = sc.downloadFileMaybe(post, rawURL)
+		}
+	}
+
+	if err == nil {
+		post.addFile(rawURL, r)
+	}
+
+	// left out on purpose, so it's neither downloaded nor failed
+	if err == errSkipped {
+		err = nil
 	}
 
 	// ignore 404 errors
 	if err == errFileNotFound {
 		log.Printf("%s: did not find %s", sc.link, rawURL)
+		atomic.AddInt64(&sc.scraper.stats.FilesMissing, 1)
 		err = nil
 	}
 
-	if err != nil {
+	// an interrupted download isn't a failure, it'll be retried next time
+	if err != nil && !isCanceled(sc.ctx, err) {
 		log.Printf("%s: failed to download file: %v", sc.link, err)
-		// err = nil // not sure if it'll be a good idea to just move on if a download fails
+		err = sc.recordFailure(post, rawURL, err)
 	}
 
 	return err
 }
 
+// gives up on a download for good, so its post doesn't hold back the cursor forever
+func (sc *scrapeContext) recordFailure(post *post, rawURL string, cause error) error {
+	post.metaLock.Lock()
+	post.failed = true
+	post.metaLock.Unlock()
+	atomic.AddInt64(&sc.failures, 1)
+
+	if atomic.AddInt64(&sc.scraper.stats.FilesFailed, 1) == int64(sc.config.ErrorThreshold) {
+		sc.notifyErrorThreshold(cause)
+	}
+
+	return sc.scraper.db.RecordFailure(rawURL, &database.Failure{
+		Blog:   sc.blog,
+		PostID: post.id,
+		Error:  cause.Error(),
+		Time:   time.Now(),
+	})
+}
+
+func isCanceled(ctx context.Context, err error) bool {
+	return ctx.Err() != nil || errors.Is(err, context.Canceled)
+}
+
 func (sc *scrapeContext) downloadFileMaybe(post *post, rawURL string) error {
 	u, err := url.Parse(rawURL)
 	if err != nil {
@@ -377,13 +822,19 @@ func (sc *scrapeContext) downloadFileMaybe(post *post, rawURL string) error {
 	_, err = os.Lstat(path)
 	if err == nil {
 		log.Printf("%s: skipping %s", sc.link, path)
+		atomic.AddInt64(&sc.scraper.stats.FilesSkipped, 1)
 		return nil
 	}
 
-	res, err := sc.doGetRequest(u, nil)
+	res, err := sc.doGetRequest(u, sc.mediaHeader(""))
 	if err != nil {
 		return err
 	}
+
+	if retry := sc.retryGIF(u, res); retry != nil {
+		res.Body.Close()
+		res = retry
+	}
 	defer res.Body.Close()
 
 	switch res.StatusCode {
@@ -400,6 +851,18 @@ func (sc *scrapeContext) downloadFileMaybe(post *post, rawURL string) error {
 		return fmt.Errorf("GET %s failed with: %d %s", rawURL, res.StatusCode, res.Status)
 	}
 
+	if !sc.wantMIMEType(res.Header.Get("Content-Type")) {
+		log.Printf("%s: skipping %s: unwanted type %s", sc.link, rawURL, res.Header.Get("Content-Type"))
+		atomic.AddInt64(&sc.scraper.stats.FilesSkipped, 1)
+		return errSkipped
+	}
+
+	if sc.config.MaxFileSize > 0 && res.ContentLength > sc.config.MaxFileSize {
+		log.Printf("%s: skipping %s: %d bytes is over the size limit", sc.link, rawURL, res.ContentLength)
+		atomic.AddInt64(&sc.scraper.stats.FilesSkipped, 1)
+		return errSkipped
+	}
+
 	lastModifiedString := res.Header.Get("Last-Modified")
 	if len(lastModifiedString) != 0 {
 		lastModified, err := time.Parse(time.RFC1123, lastModifiedString)
@@ -418,6 +881,7 @@ func (sc *scrapeContext) downloadFileMaybe(post *post, rawURL string) error {
 		_, err = os.Lstat(path)
 		if err == nil {
 			log.Printf("%s: skipping %s", sc.link, path)
+			atomic.AddInt64(&sc.scraper.stats.FilesSkipped, 1)
 			return nil
 		}
 	}
@@ -432,13 +896,27 @@ func (sc *scrapeContext) downloadFileMaybe(post *post, rawURL string) error {
 		return nil
 	}
 
-	_, err = io.Copy(file, res.Body)
+	var body io.Reader = res.Body
+	if sc.config.MaxFileSize > 0 {
+		// Content-Length isn't always there, so make sure we stop one byte past the limit
+		body = io.LimitReader(res.Body, sc.config.MaxFileSize+1)
+	}
+
+	n, err := io.Copy(file, body)
 	if err != nil {
 		_ = file.Close()
 		_ = os.Remove(path)
 		return err
 	}
 
+	if sc.config.MaxFileSize > 0 && n > sc.config.MaxFileSize {
+		_ = file.Close()
+		_ = os.Remove(path)
+		log.Printf("%s: skipping %s: over the size limit", sc.link, rawURL)
+		atomic.AddInt64(&sc.scraper.stats.FilesSkipped, 1)
+		return errSkipped
+	}
+
 	err = file.Close()
 	if err != nil {
 		_ = os.Remove(path)
@@ -450,22 +928,31 @@ func (sc *scrapeContext) downloadFileMaybe(post *post, rawURL string) error {
 		return err
 	}
 
+	atomic.AddInt64(&sc.scraper.stats.FilesWritten, 1)
+	atomic.AddInt64(&sc.scraper.stats.BytesWritten, n)
 	log.Printf("%s: wrote %s", sc.link, path)
+
+	sc.fireFileWritten(post, path, rawURL, res.Header.Get("Content-Type"), n)
 	return nil
 }
 
 func (sc *scrapeContext) getAPIPostsURL() *url.URL {
-	u, err := url.Parse(fmt.Sprintf("https://api.tumblr.com/v2/blog/%s/posts", sc.link))
+	u, err := url.Parse(fmt.Sprintf("%s/blog/%s/posts", sc.scraper.apiBase, sc.link))
 	if err != nil {
 		panic(err)
 	}
 
+	before, offset := sc.pageQuery()
+
 	vals := url.Values{
 		"api_key": {sc.config.APIKey},
-		"limit":   {"20"},
+		"limit":   {strconv.Itoa(pageLimit)},
 		"npf":     {"true"},
-		// "offset":  {strconv.FormatInt(sc.offset, 10)}, // better to use &before={timestamp}
-		"before": {strconv.FormatInt(sc.timeObj.Unix(), 10)},
+		// offset on its own shifts around as posts are added, so it's only used to get past posts sharing a second
+		"before": {before},
+	}
+	if len(offset) != 0 {
+		vals.Set("offset", offset)
 	}
 
 	u.RawQuery = vals.Encode()
@@ -474,25 +961,27 @@ func (sc *scrapeContext) getAPIPostsURL() *url.URL {
 }
 
 func (sc *scrapeContext) doGetRequest(url *url.URL, header http.Header) (*http.Response, error) {
+	return sc.doRequest(http.MethodGet, url, header)
+}
+
+func (sc *scrapeContext) doRequest(method string, url *url.URL, header http.Header) (*http.Response, error) {
 	if header == nil {
 		header = make(http.Header)
 	}
 
 	req := &http.Request{
-		Method: http.MethodGet,
+		Method: method,
 		URL:    url,
 		Header: header,
 	}
 	req = req.WithContext(sc.ctx)
-	return sc.scraper.client.Do(req)
-}
 
-func (sc *scrapeContext) fixupURL(url string) string {
-	if strings.HasSuffix(url, ".mp4") {
-		return videoURLFixupRegexp.ReplaceAllString(url, ".mp4")
+	res, err := sc.scraper.client.Do(req)
+	if err == nil && res.StatusCode == http.StatusTooManyRequests && strings.HasPrefix(url.String(), sc.scraper.apiBase) {
+		sc.notifyQuotaExhausted(res)
 	}
 
-	return imageSizeFixupRegexp.ReplaceAllString(url, "_1280.$1")
+	return res, err
 }
 
 func (sc *scrapeContext) fixupFilePath(res *http.Response, path string) string {
@@ -0,0 +1,53 @@
+package scraper
+
+import "log"
+
+// looks the post up in the db and sets post.known if it doesn't need scraping again
+func (sc *scrapeContext) checkKnown(p *post) {
+	hash, found, err := sc.scraper.db.PostHash(sc.blog, p.id)
+	if err != nil {
+		log.Printf("%s: failed to look up post %d: %v", sc.link, p.id, err)
+		return
+	}
+
+	if !found {
+		return
+	}
+
+	if hash != p.hash && sc.config.ReprocessChanged {
+		log.Printf("%s: post %d changed since it was last scraped, scraping it again", sc.link, p.id)
+		return
+	}
+
+	p.known = true
+}
+
+// records a post in the db once all of its downloads are settled
+func (sc *scrapeContext) postSettled(p *post) {
+	// dry runs don't download anything, so there's nothing to remember
+	if p.known || sc.plan != nil {
+		return
+	}
+
+	p.metaLock.Lock()
+	failed := p.failed
+	p.metaLock.Unlock()
+
+	// posts with failed downloads stay unknown, so the next run tries them again
+	if failed {
+		log.Printf("%s: not recording post %d, some of its files failed", sc.link, p.id)
+	} else {
+		err := sc.scraper.db.MarkPost(sc.blog, p.id, p.hash)
+		if err != nil {
+			log.Printf("%s: failed to record post %d: %v", sc.link, p.id, err)
+		}
+	}
+
+	// what was downloaded, in which size, and what couldn't be
+	err := sc.writePostMeta(p)
+	if err != nil {
+		log.Printf("%s: failed to write metadata of post %d: %v", sc.link, p.id, err)
+	}
+
+	sc.firePostDone(p)
+}
@@ -0,0 +1,132 @@
+package scraper
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSyncRetriesFailedPosts(t *testing.T) {
+	const top = 1500000000
+
+	posts := postsFrom(1, top, 3)
+	posts[1].Image = "broken.jpg"
+
+	api := &fakeAPI{posts: posts}
+	api.setMedia("broken.jpg", http.StatusBadRequest)
+
+	ts := newTestScraper(t, api)
+	defer ts.close()
+
+	ts.scrape(t, &Options{Sync: true})
+
+	scraped := ts.scraped(t, posts)
+	if !scraped[posts[0].ID] || !scraped[posts[2].ID] {
+		t.Errorf("posts without failed files weren't recorded: %v", scraped)
+	}
+	if scraped[posts[1].ID] {
+		t.Fatal("post with a failed file was recorded, so it'd never be tried again")
+	}
+
+	api.setMedia("broken.jpg", http.StatusOK)
+	ts.scrape(t, &Options{Sync: true})
+
+	if !ts.scraped(t, posts)[posts[1].ID] {
+		t.Error("the next sync didn't retry the post whose file failed")
+	}
+}
+
+func TestSyncPastRepeatedSecond(t *testing.T) {
+	const second = 1500000000
+
+	shared := postsAt(100, second, 25)
+	older := postsFrom(200, second-1, 5)
+
+	var posts []fakePost
+	posts = append(posts, shared...)
+	posts = append(posts, older...)
+
+	api := &fakeAPI{posts: posts}
+	ts := newTestScraper(t, api)
+	defer ts.close()
+
+	// a page of repeats from the cursor's second has no unknown posts, but isn't the end of a sync either
+	ts.scrape(t, &Options{Sync: true})
+
+	if scraped := ts.scraped(t, posts); len(scraped) != len(posts) {
+		t.Errorf("sync scraped %d of %d posts", len(scraped), len(posts))
+	}
+}
+
+func TestSyncFindsEditedPosts(t *testing.T) {
+	const top = 1500000000
+
+	posts := postsFrom(1, top, 50)
+	for i := range posts {
+		posts[i].Image = "a.jpg"
+		posts[i].Trail = make([]fakeTrail, 1)
+		posts[i].Trail[0].Blog.Name = "root"
+	}
+
+	api := &fakeAPI{posts: posts}
+	ts := newTestScraper(t, api)
+	defer ts.close()
+	ts.cfg.ReprocessChanged = true
+
+	ts.scrape(t, &Options{Sync: true})
+	before := ts.Stats().Posts
+
+	// notes and the trail's blog change all the time, only the edit on the third page should count
+	edited := &posts[45]
+	edited.Image = "b.jpg"
+	for i := range posts {
+		posts[i].NoteCount += 10
+		posts[i].Trail[0].Blog.Title = "renamed"
+	}
+	api.updated = top + 100
+
+	ts.scrape(t, &Options{Sync: true})
+
+	if n := ts.Stats().Posts - before; n != 1 {
+		t.Errorf("the second sync scraped %d posts, want only the edited one", n)
+	}
+	if _, err := os.Stat(filepath.Join(ts.cfg.Save, "b.jpg")); err != nil {
+		t.Errorf("the edited post's new image wasn't downloaded: %v", err)
+	}
+}
+
+func TestBlogScrapeWritesPostMeta(t *testing.T) {
+	const top = 1500000000
+
+	posts := postsFrom(1, top, 3)
+	posts[0].Image = "a.jpg"
+	posts[0].Link = "https://example.com"
+
+	api := &fakeAPI{posts: posts}
+	ts := newTestScraper(t, api)
+	defer ts.close()
+
+	ts.scrape(t, nil)
+
+	data, err := ioutil.ReadFile(filepath.Join(ts.cfg.Save, "meta", testBlog, "1.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var meta postMeta
+	err = json.Unmarshal(data, &meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := api.base + "/media/a.jpg"
+	if len(meta.Files) != 1 || meta.Files[0].URL != want || meta.Files[0].Resolved != want {
+		t.Errorf("files in the metadata are %+v, want %s resolved to itself", meta.Files, want)
+	}
+	if len(meta.External) != 1 || meta.External[0].URL != "https://example.com" {
+		t.Errorf("external embeds in the metadata are %+v, want the link", meta.External)
+	}
+}
@@ -0,0 +1,148 @@
+package scraper
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// counters for everything a Scraper did, across all of its scrapes
+type Stats struct {
+	Pages        int64 `json:"pages"`
+	Posts        int64 `json:"posts"`
+	PostsKnown   int64 `json:"posts_known"` // skipped because an earlier run scraped them
+	FilesWritten int64 `json:"files_written"`
+	BytesWritten int64 `json:"bytes_written"`
+	FilesSkipped int64 `json:"files_skipped"`
+	FilesMissing int64 `json:"files_missing"` // 404s and the like
+	FilesFailed  int64 `json:"files_failed"`
+}
+
+// a copy of the counters so far
+func (s *Scraper) Stats() Stats {
+	return Stats{
+		Pages:        atomic.LoadInt64(&s.stats.Pages),
+		Posts:        atomic.LoadInt64(&s.stats.Posts),
+		PostsKnown:   atomic.LoadInt64(&s.stats.PostsKnown),
+		FilesWritten: atomic.LoadInt64(&s.stats.FilesWritten),
+		BytesWritten: atomic.LoadInt64(&s.stats.BytesWritten),
+		FilesSkipped: atomic.LoadInt64(&s.stats.FilesSkipped),
+		FilesMissing: atomic.LoadInt64(&s.stats.FilesMissing),
+		FilesFailed:  atomic.LoadInt64(&s.stats.FilesFailed),
+	}
+}
+
+// URLs that are being downloaded right now, and since when
+type inFlight struct {
+	lock sync.Mutex
+	urls map[string]time.Time
+}
+
+func (f *inFlight) add(rawURL string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.urls == nil {
+		f.urls = make(map[string]time.Time)
+	}
+	f.urls[rawURL] = time.Now()
+}
+
+func (f *inFlight) remove(rawURL string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	delete(f.urls, rawURL)
+}
+
+func (f *inFlight) list() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	now := time.Now()
+	list := make([]string, 0, len(f.urls))
+	for u, since := range f.urls {
+		list = append(list, fmt.Sprintf("%s (%v)", u, now.Sub(since).Round(time.Second)))
+	}
+	sort.Strings(list)
+
+	return list
+}
+
+// pausing blocks everything that needs the semaphore, i.e. fetching pages and starting downloads
+// returns whether we're paused now
+func (s *Scraper) TogglePause() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// pausing now would only get in the way of stopping
+	if s.stopping {
+		return false
+	}
+
+	s.paused = !s.paused
+
+	if s.current != nil {
+		if s.paused {
+			s.current.sema.Pause()
+		} else {
+			s.current.sema.Resume()
+		}
+	}
+
+	return s.paused
+}
+
+// unpauses for good, for stopping
+func (s *Scraper) resume() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.stopping = true
+	if !s.paused {
+		return
+	}
+
+	s.paused = false
+	if s.current != nil {
+		s.current.sema.Resume()
+	}
+	log.Print("resuming to stop")
+}
+
+// writes a human readable snapshot of what the scraper is doing
+func (s *Scraper) Status(w io.Writer) {
+	s.lock.Lock()
+	sc := s.current
+	paused := s.paused
+	s.lock.Unlock()
+
+	st := s.Stats()
+
+	if sc == nil {
+		fmt.Fprintln(w, "status: idle")
+	} else {
+		sema := sc.sema.Stats()
+		flying := sc.inFlight.list()
+
+		fmt.Fprintf(w, "status: scraping %s\n", sc.link)
+		fmt.Fprintf(w, "  cursor:     fetching before %v\n", time.Unix(atomic.LoadInt64(&sc.cursorUnix), 0).Format("2Jan06 15:04:05"))
+		fmt.Fprintf(w, "  semaphore:  %d/%d in use, %d waiting\n", sema.Allocated, sema.Capacity, sema.Waiters)
+		fmt.Fprintf(w, "  in flight:  %d\n", len(flying))
+		for _, u := range flying {
+			fmt.Fprintf(w, "    %s\n", u)
+		}
+	}
+
+	if paused {
+		fmt.Fprintln(w, "  paused, send SIGUSR2 to resume")
+	}
+
+	fmt.Fprintf(w, "  pages:      %d\n", st.Pages)
+	fmt.Fprintf(w, "  posts:      %d scraped, %d skipped as already scraped\n", st.Posts, st.PostsKnown)
+	fmt.Fprintf(w, "  files:      %d written (%d bytes), %d skipped, %d not found, %d failed\n", st.FilesWritten, st.BytesWritten, st.FilesSkipped, st.FilesMissing, st.FilesFailed)
+}
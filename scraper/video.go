@@ -0,0 +1,122 @@
+package scraper
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/soeux/tumtum/config"
+)
+
+// queues the best rendition of a video block, or its HLS playlist if that's all there is, and its poster
+// external videos are recorded whatever media_kinds says, like links, since nothing gets downloaded for them
+func (sc *scrapeContext) scrapeVideo(post *post, c *content) error {
+	var ms videoMedia
+	if len(c.Media) != 0 {
+		err := json.Unmarshal(c.Media, &ms)
+		if err != nil {
+			return err
+		}
+	}
+
+	rawURL := ms.best()
+	if len(rawURL) == 0 && isTumblrHosted(c.URL) && !isHLSURL(c.URL) {
+		rawURL = c.URL
+	}
+	if len(rawURL) == 0 {
+		rawURL = mediaURL(c.HLS)
+	}
+	if len(rawURL) == 0 && isHLSURL(c.URL) {
+		rawURL = c.URL
+	}
+
+	// youtube, vimeo etc. embeds aren't hosted by tumblr, so they're only written down for other tools
+	if len(rawURL) == 0 || !isTumblrHosted(rawURL) {
+		if len(c.URL) == 0 {
+			c.URL = mediaURL(c.Media)
+		}
+		sc.recordExternal(post, c)
+		return sc.queuePoster(post, c)
+	}
+
+	if sc.wantMediaKind(config.MediaVideo) {
+		err := sc.queueFile(post, rawURL)
+		if err != nil {
+			return err
+		}
+	}
+
+	return sc.queuePoster(post, c)
+}
+
+// the poster frame of a video or link block, if it has one, posters are images as far as media_kinds goes
+func (sc *scrapeContext) queuePoster(post *post, c *content) error {
+	rawURL := posterURL(c)
+	if len(rawURL) == 0 || !sc.wantMediaKind(config.MediaImage) {
+		return nil
+	}
+
+	return sc.queueFile(post, rawURL)
+}
+
+// the largest poster of a block, or ""
+func posterURL(c *content) string {
+	if len(c.Poster) == 0 {
+		return ""
+	}
+
+	var ps imageMedia
+	err := json.Unmarshal(c.Poster, &ps)
+	if err != nil || len(ps) == 0 {
+		// a single media object, if anything
+		var p imageVariant
+		if json.Unmarshal(c.Poster, &p) != nil {
+			return ""
+		}
+		return p.URL
+	}
+
+	return ps.best().URL
+}
+
+// the URL of the largest tumblr hosted rendition that isn't HLS, or ""
+func (ms videoMedia) best() string {
+	var best *mediaObject
+
+	for i := range ms {
+		m := &ms[i]
+		if !isTumblrHosted(m.URL) || isHLSURL(m.URL) {
+			continue
+		}
+		if best == nil || m.Width*m.Height > best.Width*best.Height {
+			best = m
+		}
+	}
+
+	if best == nil {
+		return ""
+	}
+	return best.URL
+}
+
+// the api has been seen giving media as a URL, a media object and a list of them
+func mediaURL(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+
+	var ms videoMedia
+	if json.Unmarshal(raw, &ms) == nil && len(ms) != 0 {
+		return ms[0].URL
+	}
+
+	return ""
+}
+
+func isTumblrHosted(rawURL string) bool {
+	return strings.Contains(rawURL, "tumblr.com")
+}
@@ -0,0 +1,148 @@
+package scraper
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// how often the cursor gets saved during a scrape
+const checkpointInterval = 30 * time.Second
+
+// tracks which posts have all of their downloads settled, i.e. finished or recorded as failed
+// posts are scraped newest first, so the cursor can only move past a post once it and every post before it are settled
+// otherwise an interrupted scrape would never come back for downloads that were still in flight
+type watermark struct {
+	lock sync.Mutex
+
+	// posts in the order they were scraped
+	pending []*post
+	// the timestamp of the oldest post that's settled along with everything before it
+	settled time.Time
+	dirty   bool
+
+	// called for every post once it's settled, in scraping order, without the lock held
+	onSettled func(p *post)
+	// serializes onSettled calls so they stay in order
+	callbackLock sync.Mutex
+}
+
+// bookkeeping for a post in the watermark, guarded by watermark.lock
+type pendingState struct {
+	downloads  int  // queued but not settled yet
+	sealed     bool // all of the post's downloads have been queued
+	outOfOrder bool // pinned and the like, these never move the cursor
+}
+
+// must be called in scraping order, before any of the post's downloads are queued
+func (w *watermark) begin(p *post) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.pending = append(w.pending, p)
+}
+
+func (w *watermark) queued(p *post) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	p.pending.downloads++
+}
+
+func (w *watermark) finished(p *post) {
+	w.callbackLock.Lock()
+	defer w.callbackLock.Unlock()
+
+	w.lock.Lock()
+	p.pending.downloads--
+	settled := w.advance()
+	w.lock.Unlock()
+
+	w.notify(settled)
+}
+
+// called once scrapePost is done with the post
+func (w *watermark) seal(p *post) {
+	w.callbackLock.Lock()
+	defer w.callbackLock.Unlock()
+
+	w.lock.Lock()
+	p.pending.sealed = true
+	settled := w.advance()
+	w.lock.Unlock()
+
+	w.notify(settled)
+}
+
+// returns the posts that just got settled
+func (w *watermark) advance() (settled []*post) {
+	for len(w.pending) != 0 {
+		p := w.pending[0]
+		if !p.pending.sealed || p.pending.downloads != 0 {
+			return
+		}
+
+		w.pending[0] = nil
+		w.pending = w.pending[1:]
+		if !p.pending.outOfOrder {
+			w.settled = p.timestamp()
+			w.dirty = true
+		}
+		settled = append(settled, p)
+	}
+	return
+}
+
+func (w *watermark) notify(settled []*post) {
+	if w.onSettled == nil {
+		return
+	}
+
+	for _, p := range settled {
+		w.onSettled(p)
+	}
+}
+
+// returns the cursor if it moved since the last call
+func (w *watermark) checkpoint() (time.Time, bool) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if !w.dirty || w.settled.IsZero() {
+		return time.Time{}, false
+	}
+
+	w.dirty = false
+	return w.settled, true
+}
+
+// saves the cursor every checkpointInterval until done is closed
+func (sc *scrapeContext) checkpointLoop(done <-chan struct{}) {
+	t := time.NewTicker(checkpointInterval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-t.C:
+			sc.checkpoint()
+		}
+	}
+}
+
+func (sc *scrapeContext) checkpoint() {
+	if !sc.persist {
+		return
+	}
+
+	cursor, ok := sc.watermark.checkpoint()
+	if !ok {
+		return
+	}
+
+	err := sc.scraper.db.SetTime(sc.blog, cursor)
+	if err != nil {
+		log.Printf("%s: failed to save cursor: %v", sc.link, err)
+	}
+}
@@ -0,0 +1,83 @@
+package scraper
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/soeux/tumtum/config"
+	"github.com/soeux/tumtum/webhook"
+)
+
+// like hooks, webhooks aren't sent during dry runs
+
+// sends the run-started webhook, see Finish for the other end
+func (s *Scraper) Start(opts *Options) {
+	if opts != nil && opts.dryRun() {
+		return
+	}
+
+	s.webhooks.Send(&webhook.Event{Event: config.WebhookRunStarted})
+}
+
+func (sc *scrapeContext) notifyBlogFinished(err error) {
+	if sc.plan != nil || !sc.scraper.webhooks.Has(config.WebhookBlogFinished) {
+		return
+	}
+
+	e := &webhook.Event{
+		Event:  config.WebhookBlogFinished,
+		Blog:   sc.blog,
+		Status: runStatus(err, sc.stopping()),
+		Stats:  sc.scraper.Stats(),
+	}
+	if err != nil {
+		e.Error = sc.scraper.scrub(err.Error())
+	}
+
+	sc.scraper.webhooks.Send(e)
+}
+
+// sent once, when as many files failed as error_threshold allows
+func (sc *scrapeContext) notifyErrorThreshold(cause error) {
+	if sc.plan != nil {
+		return
+	}
+
+	sc.scraper.webhooks.Send(&webhook.Event{
+		Event: config.WebhookErrorThreshold,
+		Blog:  sc.blog,
+		Error: sc.scraper.scrub(fmt.Sprintf("%d files failed to download, the last one with: %v", sc.config.ErrorThreshold, cause)),
+		Stats: sc.scraper.Stats(),
+	})
+}
+
+// tumblr answers with 429 once the api key ran out of requests, which is only worth telling once per run
+func (sc *scrapeContext) notifyQuotaExhausted(res *http.Response) {
+	if sc.plan != nil || !atomic.CompareAndSwapInt32(&sc.scraper.quotaSent, 0, 1) {
+		return
+	}
+
+	msg := fmt.Sprintf("%s %s failed with: %s", res.Request.Method, sc.link, res.Status)
+	if after := res.Header.Get("Retry-After"); len(after) != 0 {
+		msg += ", retry after " + after
+	}
+	log.Printf("%s: the api quota is exhausted", sc.link)
+
+	sc.scraper.webhooks.Send(&webhook.Event{
+		Event: config.WebhookQuotaExhausted,
+		Blog:  sc.blog,
+		Error: msg,
+		Stats: sc.scraper.Stats(),
+	})
+}
+
+// errors can have api URLs in them, and the api key has no business leaving the machine
+func (s *Scraper) scrub(msg string) string {
+	if len(s.config.APIKey) == 0 {
+		return msg
+	}
+	return strings.Replace(msg, s.config.APIKey, "REDACTED", -1)
+}
@@ -10,6 +10,15 @@ type PrioritySemaphore struct {
 	waiters   queue
 	capcacity int
 	allocated int
+	paused    bool
+}
+
+// a snapshot of the semaphore
+type Stats struct {
+	Capacity  int
+	Allocated int
+	Waiters   int
+	Paused    bool
 }
 
 func NewPrioritySemaphore(capacity int) *PrioritySemaphore {
@@ -26,7 +35,7 @@ func NewPrioritySemaphore(capacity int) *PrioritySemaphore {
 func (s *PrioritySemaphore) Acquire(priority int) {
 	s.lock.Lock()
 
-	if s.allocated < s.capcacity {
+	if !s.paused && s.allocated < s.capcacity {
 		s.allocated++
 		s.lock.Unlock()
 		return
@@ -44,14 +53,46 @@ func (s *PrioritySemaphore) Release() {
 	s.lock.Lock()
 
 	s.allocated--
+	s.wakeWaiters()
+
+	s.lock.Unlock()
+}
+
+// new acquisitions block until Resume, whoever holds the semaphore already keeps it
+func (s *PrioritySemaphore) Pause() {
+	s.lock.Lock()
+	s.paused = true
+	s.lock.Unlock()
+}
+
+func (s *PrioritySemaphore) Resume() {
+	s.lock.Lock()
 
-	for s.allocated < s.capcacity && s.waiters.Len() != 0 {
+	s.paused = false
+	s.wakeWaiters()
+
+	s.lock.Unlock()
+}
+
+func (s *PrioritySemaphore) Stats() Stats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return Stats{
+		Capacity:  s.capcacity,
+		Allocated: s.allocated,
+		Waiters:   s.waiters.Len(),
+		Paused:    s.paused,
+	}
+}
+
+// s.lock must be held
+func (s *PrioritySemaphore) wakeWaiters() {
+	for !s.paused && s.allocated < s.capcacity && s.waiters.Len() != 0 {
 		e := heap.Pop(&s.waiters).(queueEntry)
 		close(e.ch)
 		s.allocated++
 	}
-
-	s.lock.Unlock()
 }
 
 type queueEntry struct {
@@ -0,0 +1,200 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/soeux/tumtum/config"
+)
+
+const (
+	// which event the body is, so receivers can route without parsing it
+	EventHeader = "X-Tumtum-Event"
+	// "sha256=" and the hex HMAC-SHA256 of the body, keyed with the webhook's secret, see Sign
+	SignatureHeader = "X-Tumtum-Signature"
+)
+
+// events waiting to be delivered to a webhook, newer ones are dropped once it's full
+const queueSize = 64
+
+// the JSON that's POSTed
+type Event struct {
+	Event string    `json:"event"`
+	Time  time.Time `json:"time"`
+	Blog  string    `json:"blog,omitempty"`
+	// "ok", "stopped" or "error", for events about something finishing
+	Status string `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// the counters of the run so far, i.e. scraper.Stats
+	Stats interface{} `json:"stats,omitempty"`
+}
+
+// delivers events to the webhooks in tumtum.toml in the background, in order for each of them
+type Notifier struct {
+	client  *http.Client
+	targets []*target
+	// before the first retry, doubled for every one after it
+	backoff time.Duration
+	wg      sync.WaitGroup
+
+	closeOnce sync.Once
+}
+
+type target struct {
+	config.Webhook
+	queue chan *delivery
+}
+
+type delivery struct {
+	event string
+	body  []byte
+}
+
+// cfg has to be validated
+func New(client *http.Client, cfg *config.Config) *Notifier {
+	n := &Notifier{
+		client:  client,
+		backoff: time.Second,
+	}
+
+	for _, w := range cfg.Webhooks {
+		t := &target{Webhook: w, queue: make(chan *delivery, queueSize)}
+		n.targets = append(n.targets, t)
+
+		n.wg.Add(1)
+		go n.worker(t)
+	}
+
+	return n
+}
+
+// whether any webhook wants event, so callers can skip putting it together
+func (n *Notifier) Has(event string) bool {
+	for _, t := range n.targets {
+		if t.Wants(event) {
+			return true
+		}
+	}
+	return false
+}
+
+// queues e for every webhook that wants it, without waiting for it to be delivered
+func (n *Notifier) Send(e *Event) {
+	if !n.Has(e.Event) {
+		return
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	body, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("webhook: failed to encode %s: %v", e.Event, err)
+		return
+	}
+
+	for _, t := range n.targets {
+		if !t.Wants(e.Event) {
+			continue
+		}
+
+		select {
+		case t.queue <- &delivery{event: e.Event, body: body}:
+		default:
+			log.Printf("webhook: dropping %s for %s, too many deliveries are waiting", e.Event, t.URL)
+		}
+	}
+}
+
+// waits for the events sent so far to be delivered, or given up on, after which Send mustn't be called
+func (n *Notifier) Close() {
+	n.closeOnce.Do(func() {
+		for _, t := range n.targets {
+			close(t.queue)
+		}
+	})
+
+	n.wg.Wait()
+}
+
+func (n *Notifier) worker(t *target) {
+	defer n.wg.Done()
+
+	for d := range t.queue {
+		err := n.deliver(t, d)
+		if err != nil {
+			log.Printf("webhook: failed to deliver %s to %s: %v", d.event, t.URL, err)
+		}
+	}
+}
+
+// tries up to 1+Retries times, waiting longer after every failure
+func (n *Notifier) deliver(t *target, d *delivery) error {
+	wait := n.backoff
+
+	for attempt := 0; ; attempt++ {
+		retry, err := n.post(t, d)
+		if err == nil {
+			return nil
+		}
+
+		if !retry || attempt >= t.Retries {
+			return err
+		}
+
+		time.Sleep(wait)
+		wait *= 2
+	}
+}
+
+// returns whether a failure is worth retrying
+func (n *Notifier) post(t *target, d *delivery) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), t.TimeoutDuration())
+	defer cancel()
+
+	req, err := http.NewRequest(http.MethodPost, t.URL, bytes.NewReader(d.body))
+	if err != nil {
+		return false, err
+	}
+	req = req.WithContext(ctx)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "tumtum")
+	req.Header.Set(EventHeader, d.event)
+	if len(t.Secret) != 0 {
+		req.Header.Set(SignatureHeader, Sign([]byte(t.Secret), d.body))
+	}
+
+	res, err := n.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	res.Body.Close()
+
+	switch {
+	case res.StatusCode >= 200 && res.StatusCode < 300:
+		return false, nil
+	case res.StatusCode == http.StatusRequestTimeout, res.StatusCode == http.StatusTooManyRequests, res.StatusCode >= 500:
+		return true, fmt.Errorf("POST failed with: %s", res.Status)
+	default:
+		// the receiver doesn't want it, asking again won't change that
+		return false, fmt.Errorf("POST failed with: %s", res.Status)
+	}
+}
+
+// the value of SignatureHeader for body, receivers compare it against their own with hmac.Equal
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
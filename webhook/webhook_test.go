@@ -0,0 +1,223 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/soeux/tumtum/config"
+)
+
+type request struct {
+	event     string
+	signature string
+	body      []byte
+}
+
+// answers with statuses in order, and 200 once it runs out of them
+type receiver struct {
+	lock     sync.Mutex
+	statuses []int
+	requests []request
+	// called before answering, if set
+	hold func()
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+
+	if rc.hold != nil {
+		rc.hold()
+	}
+
+	rc.lock.Lock()
+	rc.requests = append(rc.requests, request{event: r.Header.Get(EventHeader), signature: r.Header.Get(SignatureHeader), body: body})
+	status := http.StatusOK
+	if len(rc.statuses) != 0 {
+		status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+	}
+	rc.lock.Unlock()
+
+	w.WriteHeader(status)
+}
+
+func (rc *receiver) received() []request {
+	rc.lock.Lock()
+	defer rc.lock.Unlock()
+	return append([]request(nil), rc.requests...)
+}
+
+// a notifier with a single webhook pointed at rc, close it when done
+func newTestNotifier(rc *receiver, w config.Webhook) (*Notifier, func()) {
+	srv := httptest.NewServer(rc)
+
+	// what Validate would fill in
+	w.URL = srv.URL
+	if len(w.Timeout) == 0 {
+		w.Timeout = "10s"
+	}
+
+	n := New(srv.Client(), &config.Config{Webhooks: []config.Webhook{w}})
+	// nobody wants to wait seconds between retries in a test
+	n.backoff = time.Millisecond
+
+	return n, func() {
+		n.Close()
+		srv.Close()
+	}
+}
+
+func TestSign(t *testing.T) {
+	rc := &receiver{}
+	n, done := newTestNotifier(rc, config.Webhook{Secret: "hunter2"})
+	defer done()
+
+	n.Send(&Event{Event: config.WebhookRunStarted, Blog: "someblog.tumblr.com"})
+	n.Close()
+
+	reqs := rc.received()
+	if len(reqs) != 1 {
+		t.Fatalf("got %d requests, want 1", len(reqs))
+	}
+
+	r := reqs[0]
+	if r.event != config.WebhookRunStarted {
+		t.Errorf("%s is %q, want %q", EventHeader, r.event, config.WebhookRunStarted)
+	}
+
+	// what a receiver would do
+	want := Sign([]byte("hunter2"), r.body)
+	if !hmac.Equal([]byte(r.signature), []byte(want)) {
+		t.Errorf("%s is %q, want %q", SignatureHeader, r.signature, want)
+	}
+	if other := Sign([]byte("hunter3"), r.body); hmac.Equal([]byte(r.signature), []byte(other)) {
+		t.Error("the signature doesn't depend on the secret")
+	}
+
+	var e Event
+	err := json.Unmarshal(r.body, &e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Event != config.WebhookRunStarted || e.Blog != "someblog.tumblr.com" || e.Time.IsZero() {
+		t.Errorf("unexpected body %s", r.body)
+	}
+}
+
+func TestNoSignatureWithoutSecret(t *testing.T) {
+	rc := &receiver{}
+	n, done := newTestNotifier(rc, config.Webhook{})
+	defer done()
+
+	n.Send(&Event{Event: config.WebhookRunStarted})
+	n.Close()
+
+	reqs := rc.received()
+	if len(reqs) != 1 {
+		t.Fatalf("got %d requests, want 1", len(reqs))
+	}
+	for _, r := range reqs {
+		if len(r.signature) != 0 {
+			t.Errorf("%s is set without a secret: %q", SignatureHeader, r.signature)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		retries  int
+		want     int
+	}{
+		{"5xx", []int{http.StatusInternalServerError, http.StatusBadGateway}, 3, 3},
+		{"429", []int{http.StatusTooManyRequests}, 3, 2},
+		{"408", []int{http.StatusRequestTimeout}, 3, 2},
+		{"gives up", []int{500, 500, 500, 500, 500}, 2, 3},
+		{"4xx", []int{http.StatusBadRequest}, 3, 1},
+		{"404", []int{http.StatusNotFound}, 3, 1},
+		{"ok", nil, 3, 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := &receiver{statuses: tt.statuses}
+			n, done := newTestNotifier(rc, config.Webhook{Retries: tt.retries})
+			defer done()
+
+			n.Send(&Event{Event: config.WebhookRunFinished})
+			n.Close()
+
+			if got := len(rc.received()); got != tt.want {
+				t.Errorf("got %d attempts, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvents(t *testing.T) {
+	rc := &receiver{}
+	n, done := newTestNotifier(rc, config.Webhook{Events: []string{config.WebhookBlogFinished, config.WebhookQuotaExhausted}})
+	defer done()
+
+	if n.Has(config.WebhookRunStarted) {
+		t.Errorf("wants %s, which isn't in its events", config.WebhookRunStarted)
+	}
+	if !n.Has(config.WebhookBlogFinished) {
+		t.Errorf("doesn't want %s, which is in its events", config.WebhookBlogFinished)
+	}
+
+	for _, event := range []string{config.WebhookRunStarted, config.WebhookBlogFinished, config.WebhookErrorThreshold, config.WebhookQuotaExhausted, config.WebhookRunFinished} {
+		n.Send(&Event{Event: event})
+	}
+	n.Close()
+
+	var got []string
+	for _, r := range rc.received() {
+		got = append(got, r.event)
+	}
+	if len(got) != 2 || got[0] != config.WebhookBlogFinished || got[1] != config.WebhookQuotaExhausted {
+		t.Errorf("got %q, want %q", got, []string{config.WebhookBlogFinished, config.WebhookQuotaExhausted})
+	}
+}
+
+func TestCloseDrains(t *testing.T) {
+	release := make(chan struct{})
+	rc := &receiver{hold: func() { <-release }}
+	n, done := newTestNotifier(rc, config.Webhook{})
+	defer done()
+
+	const sent = 10
+	for i := 0; i < sent; i++ {
+		n.Send(&Event{Event: config.WebhookBlogFinished})
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		n.Close()
+		close(closed)
+	}()
+
+	select {
+	case <-closed:
+		t.Fatal("Close returned with deliveries still waiting")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+
+	select {
+	case <-closed:
+	case <-time.After(10 * time.Second):
+		t.Fatal("Close never returned")
+	}
+
+	if got := len(rc.received()); got != sent {
+		t.Errorf("got %d of %d events after Close", got, sent)
+	}
+}